@@ -0,0 +1,47 @@
+#!/bin/bash
+# Times the recursion- and loop-heavy scripts in bench/ and checks that they
+# print the same result on every build compared.
+#
+# usage: bench/run.sh [lox options...]
+#
+# OLD selects a revision to compare the current build against, like
+# OLD=HEAD~1 bench/run.sh --engine=vm.
+
+set -e
+cd "$(git rev-parse --show-toplevel)"
+
+tmp=$(mktemp -d)
+trap 'rm -rf "$tmp"' EXIT
+
+go build -o "$tmp/lox-new" ./cmd/main.go
+builds=(new)
+if [ -n "$OLD" ]; then
+	mkdir "$tmp/old"
+	git archive "$OLD" | tar -x -C "$tmp/old"
+	(cd "$tmp/old" && go build -o "$tmp/lox-old" ./cmd/main.go)
+	builds=(old new)
+fi
+
+# measure prints the seconds lox $1 takes to run $2 and stores its output.
+measure() {
+	local start end
+	start=$(date +%s%N)
+	"$1" run "${@:3}" "$2" > "$tmp/output-$(basename "$1")" 2>&1
+	end=$(date +%s%N)
+	echo "$(( (end - start) / 1000000 ))" | awk '{ printf "%.3f", $1 / 1000 }'
+}
+
+printf "%-14s" script
+for build in "${builds[@]}"; do printf " %10s" "$build"; done
+echo
+for script in bench/*.lox; do
+	printf "%-14s" "$(basename "$script")"
+	for build in "${builds[@]}"; do
+		printf " %10s" "$(measure "$tmp/lox-$build" "$script" "$@")"
+	done
+	echo
+	if [ -n "$OLD" ] && ! cmp -s "$tmp/output-lox-old" "$tmp/output-lox-new"; then
+		echo "  output differs:"
+		diff "$tmp/output-lox-old" "$tmp/output-lox-new" | sed 's/^/  /'
+	fi
+done
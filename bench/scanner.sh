@@ -0,0 +1,60 @@
+#!/bin/bash
+# Compares the time `lox tokenize` takes with the current scanner and with the
+# regex-based one it replaced, on inputs made of the tests and examples
+# repeated up to each size.
+#
+# usage: bench/scanner.sh [megabytes]
+#
+# OLD selects the revision to compare against and LIMIT the seconds a single
+# run may take before it is stopped.
+
+set -e
+cd "$(git rev-parse --show-toplevel)"
+
+megabytes=${1:-2}
+limit=${LIMIT:-120}
+old=${OLD:-$(git log -1 --format=%H -S regexp.MustCompile -- cmd/lox/scanner.go)^}
+
+tmp=$(mktemp -d)
+trap 'rm -rf "$tmp"' EXIT
+
+mkdir "$tmp/old"
+git archive "$old" | tar -x -C "$tmp/old"
+(cd "$tmp/old" && go build -o "$tmp/lox-old" ./cmd/main.go)
+go build -o "$tmp/lox-new" ./cmd/main.go
+
+sources=$(find tests examples -name '*.lox' | sort)
+
+# input writes whole source files to $2 until it holds at least $1 bytes.
+input() {
+	: > "$2"
+	while [ "$(wc -c < "$2")" -lt "$1" ]; do
+		cat $sources >> "$2"
+	done
+}
+
+# measure prints the seconds lox $1 takes to tokenize $2.
+measure() {
+	local start end status=0
+	start=$(date +%s%N)
+	timeout "$limit" "$1" tokenize "$2" > /dev/null 2>&1 || status=$?
+	end=$(date +%s%N)
+	if [ "$status" -eq 124 ]; then
+		echo ">$limit"
+	else
+		echo "$(( (end - start) / 1000000 ))" | awk '{ printf "%.3f", $1 / 1000 }'
+	fi
+}
+
+printf "%-10s %10s %10s %10s\n" size old new speedup
+for bytes in 65536 262144 $((megabytes * 1024 * 1024)); do
+	input "$bytes" "$tmp/input.lox"
+	size=$(wc -c < "$tmp/input.lox")
+	old_time=$(measure "$tmp/lox-old" "$tmp/input.lox")
+	new_time=$(measure "$tmp/lox-new" "$tmp/input.lox")
+	speedup=$(awk -v o="$old_time" -v n="$new_time" 'BEGIN {
+		if (o ~ />/) printf ">%dx", substr(o, 2) / (n > 0 ? n : 0.001)
+		else printf "%.0fx", o / (n > 0 ? n : 0.001)
+	}')
+	printf "%-10s %10s %10s %10s\n" "$((size / 1024))K" "$old_time" "$new_time" "$speedup"
+done
@@ -2,6 +2,7 @@ package lox
 
 import (
 	"fmt"
+	"io"
 	"strings"
 )
 
@@ -9,9 +10,13 @@ const (
 	BLOCK     = "BLOCK"
 	BLOCK_END = "BLOCK_END"
 	GROUP     = "GROUP"
+	STATIC    = "STATIC"
+	GETTER    = "GET"
 )
 
-type astPrinter struct{}
+type astPrinter struct {
+	out io.Writer
+}
 
 func (a *astPrinter) print(stmts []stmt) {
 	for _, s := range stmts {
@@ -23,127 +28,305 @@ func (a *astPrinter) printExpr(e expression) {
 	if e == nil {
 		return
 	}
-	fmt.Println(e.accept(a))
+	fmt.Fprintln(a.out, a.string(e))
 }
 
-func (a *astPrinter) visitClassStmt(stmt *stmtClass) {
-	fmt.Println(CLASS + ":" + stmt.name.lexeme)
+func (a *astPrinter) visitClassStmt(stmt *stmtClass) completion {
+	if stmt.superclass != nil {
+		fmt.Fprintln(a.out, CLASS+":"+stmt.name.lexeme+" < "+stmt.superclass.lexeme())
+	} else {
+		fmt.Fprintln(a.out, CLASS+":"+stmt.name.lexeme)
+	}
+	for _, field := range stmt.staticFields {
+		a.prefix(STATIC)
+		field.accept(a)
+	}
+	for _, method := range stmt.staticMethods {
+		a.prefix(STATIC)
+		method.accept(a)
+	}
 	for _, method := range stmt.methods {
 		method.accept(a)
 	}
-	fmt.Println(CLASS + "_END")
+	fmt.Fprintln(a.out, CLASS+"_END")
+	return completion{}
 }
 
-func (a *astPrinter) visitFunStmt(s *stmtFun) {
+func (a *astPrinter) visitFunStmt(s *stmtFun) completion {
+	if s.getter {
+		fmt.Fprintln(a.out, GETTER+":"+s.name.lexeme)
+		s.body.accept(a)
+		return completion{}
+	}
 	a.prefix(fmt.Sprintf("%s:%s", FUN, s.name.lexeme))
 	p := []string{}
-	for _, param := range s.params {
-		p = append(p, param.lexeme)
+	for index, param := range s.params {
+		switch {
+		case s.variadic && index == len(s.params)-1:
+			p = append(p, "..."+param.lexeme)
+		case s.defaults[index] != nil:
+			p = append(p, param.lexeme+" = "+a.string(s.defaults[index]))
+		default:
+			p = append(p, param.lexeme)
+		}
 	}
-	fmt.Println("[", strings.Join(p, ", "), "]")
+	fmt.Fprintln(a.out, "[", strings.Join(p, ", "), "]")
 	s.body.accept(a)
+	return completion{}
 }
 
-func (a *astPrinter) visitVarStmt(s *stmtVar) {
+func (a *astPrinter) visitVarStmt(s *stmtVar) completion {
 	a.prefix(VAR + ":" + s.name.lexeme)
 	a.printExpr(s.initializer)
+	return completion{}
 }
 
-func (a *astPrinter) visitIfStmt(s *stmtIf) {
+func (a *astPrinter) visitIfStmt(s *stmtIf) completion {
 	a.prefix(IF)
 	a.printExpr(s.condition)
 	s.thenBranch.accept(a)
 	if s.elseBranch != nil {
-		fmt.Println(ELSE)
+		fmt.Fprintln(a.out, ELSE)
 		s.elseBranch.accept(a)
 	}
+	return completion{}
 }
 
-func (a *astPrinter) visitReturnStmt(s *stmtReturn) {
+func (a *astPrinter) visitReturnStmt(s *stmtReturn) completion {
 	a.prefix(RETURN)
 	a.printExpr(s.value)
+	return completion{}
 }
 
-func (a *astPrinter) visitWhileStmt(s *stmtWhile) {
+func (a *astPrinter) visitWhileStmt(s *stmtWhile) completion {
 	a.prefix(WHILE)
 	a.printExpr(s.condition)
 	s.body.accept(a)
+	a.printExpr(s.increment)
+	return completion{}
+}
+
+func (a *astPrinter) visitForInStmt(s *stmtForIn) completion {
+	a.prefix(FOR + ":" + s.name.lexeme + " in")
+	a.printExpr(s.iterable)
+	s.body.accept(a)
+	return completion{}
+}
+
+func (a *astPrinter) visitTryStmt(s *stmtTry) completion {
+	fmt.Fprintln(a.out, TRY)
+	s.body.accept(a)
+	if s.catchBody != nil {
+		fmt.Fprintln(a.out, CATCH+":"+s.catchName.lexeme)
+		s.catchBody.accept(a)
+	}
+	if s.finallyBody != nil {
+		fmt.Fprintln(a.out, FINALLY)
+		s.finallyBody.accept(a)
+	}
+	return completion{}
+}
+
+func (a *astPrinter) visitThrowStmt(s *stmtThrow) completion {
+	a.prefix(THROW)
+	a.printExpr(s.value)
+	return completion{}
 }
 
-func (a *astPrinter) visitBlockStmt(s *stmtBlock) {
-	fmt.Println(BLOCK)
+func (a *astPrinter) visitYieldStmt(s *stmtYield) completion {
+	a.prefix(YIELD)
+	a.printExpr(s.value)
+	return completion{}
+}
+
+func (a *astPrinter) visitBreakStmt(s *stmtBreak) completion {
+	fmt.Fprintln(a.out, BREAK)
+	return completion{}
+}
+
+func (a *astPrinter) visitContinueStmt(s *stmtContinue) completion {
+	fmt.Fprintln(a.out, CONTINUE)
+	return completion{}
+}
+
+func (a *astPrinter) visitImportStmt(s *stmtImport) completion {
+	names := []string{}
+	for _, name := range s.names {
+		names = append(names, name.lexeme)
+	}
+	switch {
+	case len(names) > 0:
+		fmt.Fprintln(a.out, IMPORT+":"+s.path.lexeme, "{", strings.Join(names, ", "), "}")
+	case s.alias.lexeme != "":
+		fmt.Fprintln(a.out, IMPORT+":"+s.path.lexeme, "as", s.alias.lexeme)
+	default:
+		fmt.Fprintln(a.out, IMPORT+":"+s.path.lexeme)
+	}
+	return completion{}
+}
+
+func (a *astPrinter) visitExportStmt(s *stmtExport) completion {
+	fmt.Fprintln(a.out, EXPORT)
+	s.declaration.accept(a)
+	return completion{}
+}
+
+func (a *astPrinter) visitBlockStmt(s *stmtBlock) completion {
+	fmt.Fprintln(a.out, BLOCK)
 	for _, stmt := range s.statements {
 		stmt.accept(a)
 	}
-	fmt.Println(BLOCK_END)
+	fmt.Fprintln(a.out, BLOCK_END)
+	return completion{}
 }
 
-func (a *astPrinter) visitExprStmt(s *stmtExpr) {
+func (a *astPrinter) visitExprStmt(s *stmtExpr) completion {
 	a.printExpr(s.initializer)
+	return completion{}
+}
+
+func (a *astPrinter) visitVar(e *expressionVar) (any, error) {
+	return fmt.Sprintf("%s %s", VAR, e.lexeme()), nil
 }
 
-func (a *astPrinter) visitVar(e *expressionVar) any {
-	return fmt.Sprintf("%s %s", VAR, e.lexeme())
+func (a *astPrinter) visitAssignment(e *expressionAssignment) (any, error) {
+	return fmt.Sprintf("%s:%s %v", VAR, e.expr().lexeme(), a.string(e.next())), nil
 }
 
-func (a *astPrinter) visitAssignment(e *expressionAssignment) any {
-	return fmt.Sprintf("%s:%s %v", VAR, e.expr().lexeme(), e.next().accept(a))
+func (a *astPrinter) visitSet(e *expressionSet) (any, error) {
+	return fmt.Sprintf("%v.%v: %v", a.string(e.expression), e.name.lexeme, a.string(e.value)), nil
 }
 
-func (a *astPrinter) visitSet(e *expressionSet) any {
-	return fmt.Sprintf("%v.%v: %v", e.expression.accept(a), e.name.lexeme, e.value.accept(a))
+func (a *astPrinter) visitCompound(e *expressionCompound) (any, error) {
+	if e.postfix {
+		return fmt.Sprintf("(%v %s)", a.string(e.expression), e.operator.lexeme), nil
+	}
+	return a.parenthesized(e.operator.lexeme, e.expression, e.value), nil
 }
 
-func (a *astPrinter) visitLogical(e *expressionLogical) any {
-	return a.parenthesized(strings.ToUpper(e.lexeme()), e.expr(), e.next())
+func (a *astPrinter) visitLogical(e *expressionLogical) (any, error) {
+	return a.parenthesized(strings.ToUpper(e.lexeme()), e.expr(), e.next()), nil
 }
 
-func (a *astPrinter) visitEquality(e *expressionEquality) any {
-	return a.defaultString(e)
+func (a *astPrinter) visitEquality(e *expressionEquality) (any, error) {
+	return a.defaultString(e), nil
 }
 
-func (a *astPrinter) visitComparison(e *expressionComparison) any {
-	return a.defaultString(e)
+func (a *astPrinter) visitComparison(e *expressionComparison) (any, error) {
+	return a.defaultString(e), nil
 }
 
-func (a *astPrinter) visitTerm(e *expressionTerm) any {
-	return a.defaultString(e)
+func (a *astPrinter) visitTerm(e *expressionTerm) (any, error) {
+	return a.defaultString(e), nil
 }
 
-func (a *astPrinter) visitFactor(e *expressionFactor) any {
-	return a.defaultString(e)
+func (a *astPrinter) visitFactor(e *expressionFactor) (any, error) {
+	return a.defaultString(e), nil
 }
 
-func (a *astPrinter) visitUnary(e *expressionUnary) any {
-	return a.parenthesized(e.lexeme(), e.next())
+func (a *astPrinter) visitPower(e *expressionPower) (any, error) {
+	return a.defaultString(e), nil
 }
 
-func (a *astPrinter) visitGet(e *expressionGet) any {
-	return fmt.Sprintf("%v.%v", e.expression.accept(a), e.name.lexeme)
+func (a *astPrinter) visitBitwise(e *expressionBitwise) (any, error) {
+	return a.defaultString(e), nil
 }
 
-func (a *astPrinter) visitCall(e *expressionCall) any {
+func (a *astPrinter) visitUnary(e *expressionUnary) (any, error) {
+	return a.parenthesized(e.lexeme(), e.next()), nil
+}
+
+func (a *astPrinter) visitGet(e *expressionGet) (any, error) {
+	if e.optional {
+		return fmt.Sprintf("%v?.%v", a.string(e.expression), e.name.lexeme), nil
+	}
+	return fmt.Sprintf("%v.%v", a.string(e.expression), e.name.lexeme), nil
+}
+
+func (a *astPrinter) visitIndex(e *expressionIndex) (any, error) {
+	if e.optional {
+		return fmt.Sprintf("%v?.[%v]", a.string(e.expression), a.string(e.index)), nil
+	}
+	return fmt.Sprintf("%v[%v]", a.string(e.expression), a.string(e.index)), nil
+}
+
+func (a *astPrinter) visitIndexSet(e *expressionIndexSet) (any, error) {
+	return fmt.Sprintf("%v[%v]: %v", a.string(e.expression), a.string(e.index), a.string(e.value)), nil
+}
+
+func (a *astPrinter) visitCall(e *expressionCall) (any, error) {
 	argStr := a.joinExprs(e.args)
-	return fmt.Sprintf("(%s [%s])", e.lexeme(), argStr)
+	if e.optional {
+		return fmt.Sprintf("(%s?. [%s])", e.lexeme(), argStr), nil
+	}
+	return fmt.Sprintf("(%s [%s])", e.lexeme(), argStr), nil
+}
+
+func (a *astPrinter) visitOptional(e *expressionOptional) (any, error) {
+	return a.string(e.expression), nil
 }
 
-func (a *astPrinter) visitLiteral(e *expressionLiteral) any {
-	return a.primary(e)
+func (a *astPrinter) visitTernary(e *expressionTernary) (any, error) {
+	return a.parenthesized(e.lexeme(), e.expr(), e.next(), e.elseBranch), nil
 }
 
-func (a *astPrinter) visitGroup(e *expressionGroup) any {
-	return a.parenthesized(GROUP, e.expression)
+func (a *astPrinter) visitLiteral(e *expressionLiteral) (any, error) {
+	return a.primary(e), nil
 }
 
-func (a *astPrinter) visitExpr(e *exp) any { return "" }
+func (a *astPrinter) visitGroup(e *expressionGroup) (any, error) {
+	return a.parenthesized(GROUP, e.expression), nil
+}
+
+func (a *astPrinter) visitSpread(e *expressionSpread) (any, error) {
+	return "..." + a.string(e.expr()), nil
+}
 
-func (a *astPrinter) primary(e expression) any {
+func (a *astPrinter) visitList(e *expressionList) (any, error) {
+	return fmt.Sprintf("[%s]", a.joinExprs(e.elements)), nil
+}
+
+func (a *astPrinter) visitMap(e *expressionMap) (any, error) {
+	s := []string{}
+	for index, key := range e.keys {
+		s = append(s, fmt.Sprintf("%v: %v", a.string(key), a.string(e.values[index])))
+	}
+	return fmt.Sprintf("{%s}", strings.Join(s, ", ")), nil
+}
+
+func (a *astPrinter) visitInterpolation(e *expressionInterpolation) (any, error) {
+	return a.parenthesized(INTERPOLATION, e.parts...), nil
+}
+
+func (a *astPrinter) visitLambda(e *expressionLambda) (any, error) {
+	body := &strings.Builder{}
+	(&astPrinter{body}).visitFunStmt(e.function)
+	return strings.TrimSuffix(body.String(), "\n"), nil
+}
+
+func (a *astPrinter) visitSuper(e *expressionSuper) (any, error) {
+	return fmt.Sprintf("%s.%s", e.lexeme(), e.method.lexeme), nil
+}
+
+func (a *astPrinter) visitThis(e *expressionThis) (any, error) {
+	return e.lexeme(), nil
+}
+
+func (a *astPrinter) visitExpr(e *exp) (any, error) { return "", nil }
+
+func (a *astPrinter) primary(e expression) string {
 	if e.literal() != NULL {
 		return e.literal()
 	}
 	return e.lexeme()
 }
 
+// string returns the printed form of an expression.
+func (a *astPrinter) string(e expression) string {
+	s, _ := e.accept(a)
+	return s.(string)
+}
+
 func (a *astPrinter) parenthesized(name string, e ...expression) string {
 	joined := a.joinExprs(e)
 	return fmt.Sprintf("(%s %s)", name, joined)
@@ -153,7 +336,7 @@ func (a *astPrinter) joinExprs(e []expression) string {
 	s := []string{}
 	for _, expr := range e {
 		if expr != nil {
-			s = append(s, expr.accept(a).(string))
+			s = append(s, a.string(expr))
 		}
 	}
 	joined := strings.Join(s, " ")
@@ -165,5 +348,5 @@ func (a *astPrinter) defaultString(e expression) string {
 }
 
 func (a *astPrinter) prefix(s string) {
-	fmt.Print(s, " ")
+	fmt.Fprint(a.out, s, " ")
 }
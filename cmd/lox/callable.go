@@ -2,14 +2,26 @@ package lox
 
 import "fmt"
 
+// callable is a value that can be called. arity returns the minimum and
+// maximum number of arguments, where a maximum of -1 allows any number.
 type callable interface {
-	arity() int
-	call(*interpreter, []any, token) any
+	arity() (int, int)
+	call(*interpreter, []any, token) (any, error)
+}
+
+// loxObject is a value with properties that can be set, like instances and
+// classes with their static fields.
+type loxObject interface {
+	get(i *interpreter, name token) (any, error)
+	set(name token, value any)
 }
 
 type loxClass struct {
-	methods map[string]*loxFunction
-	name    string
+	superclass    *loxClass
+	methods       map[string]*loxFunction
+	staticMethods map[string]*loxFunction
+	fields        map[string]any
+	name          string
 }
 
 type loxInstance struct {
@@ -18,70 +30,208 @@ type loxInstance struct {
 }
 
 type loxFunction struct {
-	closure     *environment
-	declaration *stmtFun
+	closure       *environment
+	declaration   *stmtFun
+	isInitializer bool
 }
 
 type builtin struct {
-	function func(*interpreter, []any, token) any
+	function func(*interpreter, []any, token) (any, error)
 	lenArgs  int
+	// maxArgs is the maximum number of arguments if some are optional, or -1
+	// for any number.
+	maxArgs int
 }
 
 func (c *loxClass) String() string { return "<class " + c.name + ">" }
-func (c *loxClass) arity() int     { return 0 }
-func (c *loxClass) call(i *interpreter, args []any, t token) any {
+func (c *loxClass) arity() (int, int) {
+	if init := c.findMethod("init"); init != nil {
+		return init.arity()
+	}
+	return 0, 0
+}
+func (c *loxClass) call(i *interpreter, args []any, t token) (any, error) {
 	instance := &loxInstance{c, make(map[string]any)}
-	return instance
+	if init := c.findMethod("init"); init != nil {
+		if _, err := init.bind(instance).call(i, args, t); err != nil {
+			return nil, err
+		}
+	}
+	return instance, nil
+}
+
+func (c *loxClass) findMethod(name string) *loxFunction {
+	for class := c; class != nil; class = class.superclass {
+		if method, ok := class.methods[name]; ok {
+			return method
+		}
+	}
+	return nil
+}
+
+func (c *loxClass) findStatic(name string) *loxFunction {
+	for class := c; class != nil; class = class.superclass {
+		if method, ok := class.staticMethods[name]; ok {
+			return method
+		}
+	}
+	return nil
+}
+
+// get returns a static field or a static method bound to the class. Both are
+// inherited from the superclass.
+func (c *loxClass) get(i *interpreter, name token) (any, error) {
+	for class := c; class != nil; class = class.superclass {
+		if val, ok := class.fields[name.lexeme]; ok {
+			return val, nil
+		}
+	}
+	if m := c.findStatic(name.lexeme); m != nil {
+		return m.bind(c).property(i, name)
+	}
+	return nil, newError(fmt.Sprintf("Undefined property '%s'.", name.lexeme), name.line)
+}
+
+func (c *loxClass) set(name token, value any) {
+	c.fields[name.lexeme] = value
 }
 
 func (i *loxInstance) String() string { return i.class.name + " instance" }
-func (i *loxInstance) get(name token) any {
+func (i *loxInstance) get(interpreter *interpreter, name token) (any, error) {
 	val, ok := i.fields[name.lexeme]
 	if ok {
-		return val
+		return val, nil
 	}
 	m := i.findMethod(name.lexeme)
 	if m != nil {
-		return m
+		return m.bind(i).property(interpreter, name)
 	}
-	err := newError(fmt.Sprintf("Undefined property '%s'.", name.lexeme), name.line)
-	panic(err)
+	return nil, newError(fmt.Sprintf("Undefined property '%s'.", name.lexeme), name.line)
 }
 
 func (i *loxInstance) findMethod(name string) *loxFunction {
-	method, ok := i.class.methods[name]
-	if ok {
-		return method
-	}
-	return nil
+	return i.class.findMethod(name)
 }
 
 func (i *loxInstance) set(name token, value any) {
 	i.fields[name.lexeme] = value
 }
 
-func (f *loxFunction) String() string { return "<fn " + f.declaration.name.lexeme + ">" }
-func (f *loxFunction) arity() int     { return len(f.declaration.params) }
-func (f *loxFunction) call(i *interpreter, args []any, t token) (value any) {
-	defer func() {
-		if r := recover(); r != nil {
-			switch r := r.(type) {
-			case returnValue:
-				value = r.value
-				return
-			default:
-				panic(r)
+func (f *loxFunction) String() string    { return "<fn " + f.declaration.name.lexeme + ">" }
+func (f *loxFunction) arity() (int, int) { return f.declaration.arity() }
+
+// bind returns the method with 'this' set to the instance, or to the class for
+// static methods.
+func (f *loxFunction) bind(this any) *loxFunction {
+	env := newEnvironment(f.closure, 1)
+	env.define("this", this)
+	return &loxFunction{env, f.declaration, f.isInitializer}
+}
+
+// property is the value of a bound method accessed as a property, which is
+// the result of calling it for getters.
+func (f *loxFunction) property(i *interpreter, name token) (any, error) {
+	if f.declaration.getter {
+		return f.call(i, nil, name)
+	}
+	return f, nil
+}
+
+func (f *loxFunction) call(i *interpreter, args []any, t token) (any, error) {
+	if f.declaration.generator {
+		return newGenerator(f, args), nil
+	}
+	return f.run(i, args, t)
+}
+
+// run executes the body of the function. A throw out of it is returned as a
+// runtime error of the expression that called it.
+func (f *loxFunction) run(i *interpreter, args []any, t token) (any, error) {
+	i.frames = append(i.frames, callFrame{f.declaration.name.lexeme, t.line})
+	var c completion
+	if env, err := f.bindParams(i, args); err != nil {
+		c = throw(err)
+	} else {
+		c = i.executeBlock(f.declaration.body.(*stmtBlock).statements, env)
+	}
+	if c.kind == throwCompletion && !c.err.hasValue() {
+		// create the error object while the frame is still on the stack
+		c.err.value = i.errorObject(c.err.message, c.err.line)
+	}
+	i.frames = i.frames[:len(i.frames)-1]
+	if c.kind == throwCompletion {
+		return nil, c.err
+	}
+	if f.isInitializer {
+		return f.this(), nil
+	}
+	return c.value, nil
+}
+
+// bindParams defines the parameters in a new environment. Missing arguments
+// get their default values, which are evaluated on every call, and a rest
+// parameter gets a list of the remaining arguments.
+func (f *loxFunction) bindParams(i *interpreter, args []any) (*environment, error) {
+	env := newEnvironment(f.closure, f.declaration.body.(*stmtBlock).size)
+	prevEnv := i.environment
+	i.environment = env
+	params := f.declaration.paramList
+	for index, param := range params.params {
+		switch {
+		case params.variadic && index == len(params.params)-1:
+			rest := []any{}
+			if index < len(args) {
+				rest = append(rest, args[index:]...)
+			}
+			env.define(param.lexeme, newList(rest))
+		case index < len(args):
+			env.define(param.lexeme, args[index])
+		default:
+			value, err := i.evaluate(params.defaults[index])
+			if err != nil {
+				i.environment = prevEnv
+				return nil, err
 			}
+			env.define(param.lexeme, value)
 		}
-	}()
-	for i, param := range f.declaration.params {
-		f.closure.define(param.lexeme, args[i])
 	}
-	block := f.declaration.body.(*stmtBlock)
-	i.executeBlock(block.statements, newEnvironment(f.closure))
-	return
+	i.environment = prevEnv
+	return env, nil
+}
+
+func (f *loxFunction) this() any {
+	return f.closure.getAt(0, 0)
 }
 
-func (b *builtin) String() string                               { return "<native fn>" }
-func (b *builtin) arity() int                                   { return b.lenArgs }
-func (b *builtin) call(i *interpreter, args []any, t token) any { return b.function(i, args, t) }
+func (b *builtin) String() string { return "<native fn>" }
+func (b *builtin) arity() (int, int) {
+	if b.maxArgs != 0 {
+		return b.lenArgs, b.maxArgs
+	}
+	return b.lenArgs, b.lenArgs
+}
+func (b *builtin) call(i *interpreter, args []any, t token) (any, error) {
+	return b.function(i, args, t)
+}
+
+// acceptsArgs reports whether the callable can be called with count arguments.
+func acceptsArgs(c callable, count int) bool {
+	min, max := c.arity()
+	return count >= min && (max == -1 || count <= max)
+}
+
+func checkArity(c callable, count int, t token) error {
+	if acceptsArgs(c, count) {
+		return nil
+	}
+	var message string
+	switch min, max := c.arity(); {
+	case max == -1:
+		message = fmt.Sprintf("Expected at least %d arguments but got %d.", min, count)
+	case min == max:
+		message = fmt.Sprintf("Expected %d arguments but got %d.", min, count)
+	default:
+		message = fmt.Sprintf("Expected %d to %d arguments but got %d.", min, max, count)
+	}
+	return newError(message, t.line)
+}
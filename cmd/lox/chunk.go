@@ -0,0 +1,131 @@
+package lox
+
+type opCode byte
+
+const (
+	opConstant opCode = iota
+	opNil
+	opTrue
+	opFalse
+	opPop
+	opDup
+	opDup2
+	opBury
+	opGetLocal
+	opSetLocal
+	opGetGlobal
+	opSetGlobal
+	opDefineGlobal
+	opGetUpvalue
+	opSetUpvalue
+	opCloseUpvalue
+	opGetProperty
+	opGetField
+	opSetProperty
+	opGetSuper
+	opIndex
+	opSetIndex
+	opEqual
+	opNotEqual
+	opGreater
+	opGreaterEqual
+	opLess
+	opLessEqual
+	opAdd
+	opSubtract
+	opMultiply
+	opDivide
+	opModulo
+	opIntDivide
+	opPower
+	opBitAnd
+	opBitOr
+	opBitXor
+	opShiftLeft
+	opShiftRight
+	opBitNot
+	opNot
+	opNegate
+	opJump
+	opJumpIfFalse
+	opJumpIfTrue
+	opJumpIfNil
+	opJumpIfNotNil
+	opJumpIfArg
+	opLoop
+	opCall
+	opInvoke
+	opCallList
+	opClosure
+	opReturn
+	opStash
+	opReturnStashed
+	opClass
+	opSuperclass
+	opMethod
+	opStaticMethod
+	opStaticField
+	opList
+	opAppend
+	opAppendSpread
+	opMap
+	opMapSet
+	opInterpolate
+	opIter
+	opForNext
+	opCloseIter
+	opTry
+	opTryFinally
+	opEndTry
+	opFinallyJump
+	opEndFinally
+	opThrow
+	opYield
+	opJumpIfOpen
+	opImport
+	opExport
+	opError
+)
+
+// chunk is the bytecode of a function. Every byte of code has the line of
+// the source it was compiled from.
+type chunk struct {
+	code      []byte
+	lines     []int
+	constants []any
+	// literals maps the names and literals in the constant pool to their
+	// index, so they are only added once.
+	literals map[any]int
+	// nodes are the expressions of instructions whose errors quote their
+	// operands, like the arithmetic operators.
+	nodes map[int]expression
+	// calls maps the instructions inside call expressions to the line of the
+	// outermost one, which errors leaving them are reported at.
+	calls map[int]int
+}
+
+func newChunk() *chunk {
+	return &chunk{literals: make(map[any]int), nodes: make(map[int]expression), calls: make(map[int]int)}
+}
+
+func (c *chunk) write(b byte, line int) {
+	c.code = append(c.code, b)
+	c.lines = append(c.lines, line)
+}
+
+// addConstant returns the index of value in the constant pool.
+func (c *chunk) addConstant(value any) int {
+	switch value.(type) {
+	case string, float64, bool:
+		if index, ok := c.literals[value]; ok {
+			return index
+		}
+		c.literals[value] = len(c.constants)
+	}
+	c.constants = append(c.constants, value)
+	return len(c.constants) - 1
+}
+
+func (c *chunk) readShort(offset int) int {
+	return int(c.code[offset])<<8 | int(c.code[offset+1])
+}
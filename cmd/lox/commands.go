@@ -14,20 +14,16 @@ const (
 
 func Repl() {
 	s := bufio.NewScanner(os.Stdin)
-	i := newInterpreter("", "")
+	i := newInterpreter("")
 	for fmt.Print(PROMPT); s.Scan(); fmt.Print(PROMPT) {
 		if s.Text() == EXIT {
 			return
 		}
-		i.parser = newParser(s.Text())
-		stmts, parseErrors := i.parse()
+		stmts, parseErrors := newParser(s.Text()).parse()
 		if len(parseErrors) == 0 {
 			for _, stmt := range stmts {
-				switch stmt := stmt.(type) {
-				case *stmtExpr:
-					handleExpr(stmt.initializer, i)
-				default:
-					handleStmt(stmt, i)
+				if err := handleStmt(stmt, i); err != nil {
+					fmt.Fprintln(os.Stderr, replError(err.Error()))
 				}
 			}
 		}
@@ -57,7 +53,7 @@ func Parse(filePath string) bool {
 	str := getFileContent(filePath)
 	p := newParser(str)
 	stmts, errs := p.parse()
-	aP := astPrinter{}
+	aP := astPrinter{os.Stdout}
 	if len(stmts) == 1 &&
 		len(errs) == 1 &&
 		errs[0].message ==
@@ -73,34 +69,64 @@ func Parse(filePath string) bool {
 	return len(errs) == 0
 }
 
+// Disassemble prints the bytecode the file is compiled to for the VM.
+func Disassemble(filePath string) bool {
+	str := getFileContent(filePath)
+	i := newInterpreter(filePath)
+	stmts, errs := newParser(str).parse()
+	if len(errs) > 0 {
+		printErrors(errs)
+		return false
+	}
+	exitOnError(i.resolveAll(stmts))
+	function, err := compile(stmts, i.module)
+	exitOnError(err)
+	d := disassembler{os.Stdout}
+	d.function(function)
+	return true
+}
+
 func Evaluate(filePath string) bool {
-	defer exitOnError()
 	str := getFileContent(filePath)
-	dirPath := getPathFromFile(filePath)
-	i := newInterpreter(str, dirPath)
-	i.tokenize()
-	expr := i.expression()
-	errs := append(i.scanErrors, i.parseErrors...)
+	i := newInterpreter(filePath)
+	p := newParser(str)
+	p.tokenize()
+	expr := p.expression()
+	errs := append(p.scanErrors, p.parseErrors...)
 	if expr == nil {
 		printErrors(errs)
 		return len(errs) == 0
 	}
 	if len(errs) == 0 {
-		handleExprEval(expr, i)
+		str, err := i.interpretExpr(expr)
+		exitOnError(err)
+		fmt.Println(str)
 	}
 	printErrors(errs)
 	return len(errs) == 0
 }
 
 func Run(filePath string) bool {
-	defer exitOnError()
 	str := getFileContent(filePath)
-	dirPath := getPathFromFile(filePath)
-	i := newInterpreter(str, dirPath)
-	stmts, errs := i.parse()
-	i.resolver.resolve(stmts)
+	i := newInterpreter(filePath)
+	stmts, errs := newParser(str).parse()
+	if len(errs) == 0 {
+		exitOnError(i.resolveAll(stmts))
+		exitOnError(i.interpret(stmts))
+		return true
+	}
+	printErrors(errs)
+	return false
+}
+
+// RunVM runs the script at filePath by compiling it to bytecode for the VM.
+func RunVM(filePath string) bool {
+	str := getFileContent(filePath)
+	i := newInterpreter(filePath)
+	stmts, errs := newParser(str).parse()
 	if len(errs) == 0 {
-		i.interpret(stmts)
+		exitOnError(i.resolveAll(stmts))
+		exitOnError(newVM(i).interpret(stmts))
 		return true
 	}
 	printErrors(errs)
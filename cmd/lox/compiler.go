@@ -0,0 +1,965 @@
+package lox
+
+// compiler translates the statements of a function to bytecode. Local
+// variables live in stack slots, which closures capture as upvalues, and
+// variables declared at the top level of a script are globals of its module.
+type compiler struct {
+	enclosing  *compiler
+	function   *vmFunction
+	locals     []local
+	upvalues   []upvalue
+	scopeDepth int
+	loops      []*loop
+	tries      []*tryBlock
+	// optionals are the jumps of the '?.' links in the optional chains being
+	// compiled, which go to the end of their chain.
+	optionals [][]int
+	// calls is the number of call expressions being compiled, the outermost
+	// of which is at callLine.
+	calls    int
+	callLine int
+	// line is the line of the declaration of the function.
+	line int
+}
+
+type local struct {
+	name     string
+	depth    int
+	captured bool
+}
+
+type upvalue struct {
+	index   int
+	isLocal bool
+}
+
+type loop struct {
+	// locals and tries are the number of locals and try blocks when the
+	// loop started, which break and continue leave.
+	locals    int
+	tries     int
+	breaks    []int
+	continues []int
+}
+
+// tryBlock is a try statement whose handler is active. Jumps leaving it
+// remove the handler and run the finally block first, if it has one.
+type tryBlock struct {
+	finally bool
+	locals  int
+	// exits are the jumps to the finally block.
+	exits []int
+}
+
+// compile compiles the top-level code of a module to a function and returns
+// the first error found, like a chunk exceeding its limits.
+func compile(stmts []stmt, m *loxModule) (function *vmFunction, err error) {
+	defer recoverError(&err)
+	c := newCompiler(nil, none, "script", m)
+	c.line = 1
+	c.statements(stmts)
+	c.emitReturn(c.lastLine())
+	return c.function, nil
+}
+
+func newCompiler(enclosing *compiler, kind fnType, name string, m *loxModule) *compiler {
+	function := &vmFunction{name: name, chunk: newChunk(), kind: kind, module: m}
+	c := &compiler{enclosing: enclosing, function: function}
+	// slot 0 holds the receiver of methods and the callee otherwise
+	if kind == method || kind == initializer {
+		c.locals = append(c.locals, local{"this", 0, false})
+	} else {
+		c.locals = append(c.locals, local{"", 0, false})
+	}
+	return c
+}
+
+func (c *compiler) statements(stmts []stmt) {
+	for _, s := range stmts {
+		s.accept(c)
+	}
+}
+
+func (c *compiler) expression(e expression) {
+	e.accept(c)
+}
+
+func (c *compiler) chunk() *chunk {
+	return c.function.chunk
+}
+
+func (c *compiler) emit(line int, bytes ...byte) {
+	if c.calls > 0 {
+		c.chunk().calls[len(c.chunk().code)] = c.callLine
+	}
+	for _, b := range bytes {
+		c.chunk().write(b, line)
+	}
+}
+
+func (c *compiler) emitOp(op opCode, line int) {
+	c.emit(line, byte(op))
+}
+
+// emitNode emits an instruction whose errors refer to the operands of e.
+func (c *compiler) emitNode(op opCode, e expression, line int) {
+	c.chunk().nodes[len(c.chunk().code)] = e
+	c.emitOp(op, line)
+}
+
+func (c *compiler) emitShort(value int, line int) {
+	c.emit(line, byte(value>>8), byte(value))
+}
+
+func (c *compiler) emitConstant(op opCode, value any, line int) {
+	index := c.chunk().addConstant(value)
+	if index > 0xffff {
+		panic(newError("Too many constants in one chunk.", line))
+	}
+	c.emitOp(op, line)
+	c.emitShort(index, line)
+}
+
+// emitJump emits a forward jump and returns the offset of its operand.
+func (c *compiler) emitJump(op opCode, line int) int {
+	c.emitOp(op, line)
+	c.emitShort(0xffff, line)
+	return len(c.chunk().code) - 2
+}
+
+// patchJump makes the jump with the operand at offset go to the current end
+// of the code.
+func (c *compiler) patchJump(offset int) {
+	jump := len(c.chunk().code) - offset - 2
+	if jump > 0xffff {
+		panic(newError("Too much code to jump over.", c.chunk().lines[offset]))
+	}
+	c.chunk().code[offset] = byte(jump >> 8)
+	c.chunk().code[offset+1] = byte(jump)
+}
+
+func (c *compiler) emitLoop(start int, line int) {
+	c.emitOp(opLoop, line)
+	offset := len(c.chunk().code) - start + 2
+	if offset > 0xffff {
+		panic(newError("Loop body too large.", line))
+	}
+	c.emitShort(offset, line)
+}
+
+func (c *compiler) emitReturn(line int) {
+	if c.function.kind == initializer {
+		c.emit(line, byte(opGetLocal), 0)
+	} else {
+		c.emitOp(opNil, line)
+	}
+	c.emitOp(opReturn, line)
+}
+
+func (c *compiler) beginScope() {
+	c.scopeDepth++
+}
+
+func (c *compiler) endScope(line int) {
+	c.scopeDepth--
+	n := len(c.locals)
+	for n > 0 && c.locals[n-1].depth > c.scopeDepth {
+		n--
+	}
+	c.emitPops(len(c.locals), n, line)
+	c.locals = c.locals[:n]
+}
+
+// emitPops removes the locals from index from down to index to from the
+// stack, closing the captured ones, without ending their scope in the
+// compiler.
+func (c *compiler) emitPops(from int, to int, line int) {
+	for n := from - 1; n >= to; n-- {
+		if c.locals[n].captured {
+			c.emitOp(opCloseUpvalue, line)
+		} else {
+			c.emitOp(opPop, line)
+		}
+	}
+}
+
+func (c *compiler) addLocal(name string, line int) {
+	if len(c.locals) == 256 {
+		panic(newError("Too many local variables in function.", line))
+	}
+	c.locals = append(c.locals, local{name, c.scopeDepth, false})
+}
+
+// isGlobal reports whether declarations are globals of the module.
+func (c *compiler) isGlobal() bool {
+	return c.function.kind == none && c.scopeDepth == 0
+}
+
+// define declares the variable for the value on top of the stack.
+func (c *compiler) define(name token) {
+	if c.isGlobal() {
+		c.emitConstant(opDefineGlobal, name.lexeme, name.line)
+		return
+	}
+	c.addLocal(name.lexeme, name.line)
+}
+
+func (c *compiler) resolveLocal(name string) int {
+	for n := len(c.locals) - 1; n >= 0; n-- {
+		if c.locals[n].name == name {
+			return n
+		}
+	}
+	return -1
+}
+
+func (c *compiler) resolveUpvalue(name string, line int) int {
+	if c.enclosing == nil {
+		return -1
+	}
+	if local := c.enclosing.resolveLocal(name); local != -1 {
+		c.enclosing.locals[local].captured = true
+		return c.addUpvalue(local, true, line)
+	}
+	if index := c.enclosing.resolveUpvalue(name, line); index != -1 {
+		return c.addUpvalue(index, false, line)
+	}
+	return -1
+}
+
+func (c *compiler) addUpvalue(index int, isLocal bool, line int) int {
+	for n, u := range c.upvalues {
+		if u.index == index && u.isLocal == isLocal {
+			return n
+		}
+	}
+	if len(c.upvalues) == 256 {
+		panic(newError("Too many closure variables in function.", line))
+	}
+	c.upvalues = append(c.upvalues, upvalue{index, isLocal})
+	c.function.upvalueCount = len(c.upvalues)
+	return len(c.upvalues) - 1
+}
+
+func (c *compiler) getVariable(name string, line int) {
+	if slot := c.resolveLocal(name); slot != -1 {
+		c.emit(line, byte(opGetLocal), byte(slot))
+	} else if index := c.resolveUpvalue(name, line); index != -1 {
+		c.emit(line, byte(opGetUpvalue), byte(index))
+	} else {
+		c.emitConstant(opGetGlobal, name, line)
+	}
+}
+
+func (c *compiler) setVariable(name string, line int) {
+	if slot := c.resolveLocal(name); slot != -1 {
+		c.emit(line, byte(opSetLocal), byte(slot))
+	} else if index := c.resolveUpvalue(name, line); index != -1 {
+		c.emit(line, byte(opSetUpvalue), byte(index))
+	} else {
+		c.emitConstant(opSetGlobal, name, line)
+	}
+}
+
+// closure compiles a function declaration and emits the instruction creating
+// its closure.
+func (c *compiler) closure(s *stmtFun, kind fnType) {
+	fc := newCompiler(c, kind, s.name.lexeme, c.function.module)
+	fc.line = s.name.line
+	fc.function.paramList = s.paramList
+	fc.function.generator, fc.function.getter = s.generator, s.getter
+	fc.beginScope()
+	for index, param := range s.params {
+		if value := s.defaults[index]; value != nil {
+			fc.emit(param.line, byte(opJumpIfArg), byte(index))
+			skip := len(fc.chunk().code)
+			fc.emitShort(0xffff, param.line)
+			fc.expression(value)
+			fc.emit(param.line, byte(opSetLocal), byte(index+1))
+			fc.emitOp(opPop, param.line)
+			fc.patchJump(skip)
+		}
+		fc.addLocal(param.lexeme, param.line)
+	}
+	body := s.body.(*stmtBlock)
+	fc.statements(body.statements)
+	fc.emitReturn(s.name.line)
+	c.emitConstant(opClosure, fc.function, s.name.line)
+	for _, u := range fc.upvalues {
+		isLocal := byte(0)
+		if u.isLocal {
+			isLocal = 1
+		}
+		c.emit(s.name.line, isLocal, byte(u.index))
+	}
+}
+
+func (c *compiler) visitClassStmt(s *stmtClass) completion {
+	line := s.name.line
+	hasSuper := byte(0)
+	if s.superclass != nil {
+		c.expression(s.superclass)
+		line, hasSuper = s.superclass.token().line, 1
+	}
+	c.emitConstant(opClass, s.name.lexeme, line)
+	c.emit(line, hasSuper)
+	c.define(s.name)
+	if hasSuper == 1 {
+		c.beginScope()
+		c.getVariable(s.name.lexeme, s.name.line)
+		c.emitOp(opSuperclass, s.name.line)
+		c.addLocal("super", s.name.line)
+	}
+	c.getVariable(s.name.lexeme, s.name.line)
+	for _, m := range s.methods {
+		kind := method
+		if m.name.lexeme == "init" {
+			kind = initializer
+		}
+		c.closure(m, kind)
+		c.emitConstant(opMethod, m.name.lexeme, m.name.line)
+	}
+	for _, m := range s.staticMethods {
+		c.closure(m, method)
+		c.emitConstant(opStaticMethod, m.name.lexeme, m.name.line)
+	}
+	c.emitOp(opPop, s.name.line)
+	if hasSuper == 1 {
+		c.endScope(s.name.line)
+	}
+	for _, field := range s.staticFields {
+		c.getVariable(s.name.lexeme, field.name.line)
+		if field.initializer != nil {
+			c.expression(field.initializer)
+		} else {
+			c.emitOp(opNil, field.name.line)
+		}
+		c.emitConstant(opStaticField, field.name.lexeme, field.name.line)
+		c.emitOp(opPop, field.name.line)
+	}
+	return completion{}
+}
+
+func (c *compiler) visitFunStmt(s *stmtFun) completion {
+	if c.isGlobal() {
+		c.closure(s, function)
+		c.define(s.name)
+		return completion{}
+	}
+	// the function can refer to itself
+	c.addLocal(s.name.lexeme, s.name.line)
+	c.closure(s, function)
+	return completion{}
+}
+
+func (c *compiler) visitVarStmt(s *stmtVar) completion {
+	if s.initializer != nil {
+		c.expression(s.initializer)
+	} else {
+		c.emitOp(opNil, s.name.line)
+	}
+	c.define(s.name)
+	return completion{}
+}
+
+func (c *compiler) visitIfStmt(s *stmtIf) completion {
+	line := s.condition.token().line
+	c.expression(s.condition)
+	elseJump := c.emitJump(opJumpIfFalse, line)
+	c.emitOp(opPop, line)
+	s.thenBranch.accept(c)
+	endJump := c.emitJump(opJump, line)
+	c.patchJump(elseJump)
+	c.emitOp(opPop, line)
+	if s.elseBranch != nil {
+		s.elseBranch.accept(c)
+	}
+	c.patchJump(endJump)
+	return completion{}
+}
+
+func (c *compiler) visitReturnStmt(s *stmtReturn) completion {
+	if c.function.kind == initializer {
+		c.emit(s.line, byte(opGetLocal), 0)
+	} else if s.value != nil {
+		c.expression(s.value)
+	} else {
+		c.emitOp(opNil, s.line)
+	}
+	c.returnValue(s.line)
+	return completion{}
+}
+
+// returnValue returns the value on top of the stack, running the finally
+// blocks of the try blocks it leaves.
+func (c *compiler) returnValue(line int) {
+	if !c.hasFinally(0) {
+		c.emitOp(opReturn, line)
+		return
+	}
+	c.emitOp(opStash, line)
+	c.exitTries(0, line)
+	c.emitOp(opReturnStashed, line)
+}
+
+// hasFinally reports whether the try blocks from index tries on include one
+// with a finally block.
+func (c *compiler) hasFinally(tries int) bool {
+	for _, t := range c.tries[tries:] {
+		if t.finally {
+			return true
+		}
+	}
+	return false
+}
+
+// exitTries leaves the try blocks from index tries on, running their finally
+// blocks from the innermost one outwards. It returns the number of locals
+// left on the stack.
+func (c *compiler) exitTries(tries int, line int) int {
+	top := len(c.locals)
+	for n := len(c.tries) - 1; n >= tries; n-- {
+		t := c.tries[n]
+		c.emitOp(opEndTry, line)
+		if t.finally {
+			c.emitPops(top, t.locals, line)
+			top = t.locals
+			c.emitOp(opFinallyJump, line)
+			c.emitShort(3, line)
+			t.exits = append(t.exits, c.emitJump(opJump, line))
+		}
+	}
+	return top
+}
+
+func (c *compiler) visitWhileStmt(s *stmtWhile) completion {
+	line := s.condition.token().line
+	start := len(c.chunk().code)
+	c.expression(s.condition)
+	exitJump := c.emitJump(opJumpIfFalse, line)
+	c.emitOp(opPop, line)
+	l := c.beginLoop()
+	s.body.accept(c)
+	c.patchJumps(l.continues)
+	if s.increment != nil {
+		c.expression(s.increment)
+		c.emitOp(opPop, line)
+	}
+	c.emitLoop(start, line)
+	c.patchJump(exitJump)
+	c.emitOp(opPop, line)
+	c.endLoop(l)
+	return completion{}
+}
+
+// visitForInStmt runs the loop in a try block whose finally block closes the
+// iterator, so generators left by break, return or an error are closed.
+func (c *compiler) visitForInStmt(s *stmtForIn) completion {
+	c.expression(s.iterable)
+	c.emitOp(opIter, s.line)
+	c.beginScope()
+	c.addLocal(" iter", s.line)
+	slot := len(c.locals) - 1
+	fin := &tryBlock{finally: true, locals: len(c.locals)}
+	finHandler := c.emitJump(opTryFinally, s.line)
+	c.tries = append(c.tries, fin)
+	start := len(c.chunk().code)
+	c.emit(s.line, byte(opForNext), byte(slot))
+	exitJump := len(c.chunk().code)
+	c.emitShort(0xffff, s.line)
+	l := c.beginLoop()
+	c.beginScope()
+	c.addLocal(s.name.lexeme, s.name.line)
+	s.body.accept(c)
+	c.endScope(s.line)
+	c.patchJumps(l.continues)
+	c.emitLoop(start, s.line)
+	c.patchJump(exitJump)
+	c.endLoop(l)
+	c.tries = c.tries[:len(c.tries)-1]
+	c.emitOp(opEndTry, s.line)
+	c.emitOp(opNil, s.line)
+	c.patchJump(finHandler)
+	c.patchJumps(fin.exits)
+	c.emit(s.line, byte(opCloseIter), byte(slot))
+	c.emitOp(opEndFinally, s.line)
+	c.endScope(s.line)
+	return completion{}
+}
+
+func (c *compiler) beginLoop() *loop {
+	l := &loop{locals: len(c.locals), tries: len(c.tries)}
+	c.loops = append(c.loops, l)
+	return l
+}
+
+// endLoop makes the breaks of the loop jump to the current end of the code.
+func (c *compiler) endLoop(l *loop) {
+	c.loops = c.loops[:len(c.loops)-1]
+	c.patchJumps(l.breaks)
+}
+
+func (c *compiler) patchJumps(jumps []int) {
+	for _, jump := range jumps {
+		c.patchJump(jump)
+	}
+}
+
+func (c *compiler) visitBreakStmt(s *stmtBreak) completion {
+	l := c.loops[len(c.loops)-1]
+	top := c.exitTries(l.tries, s.line)
+	c.emitPops(top, l.locals, s.line)
+	l.breaks = append(l.breaks, c.emitJump(opJump, s.line))
+	return completion{}
+}
+
+func (c *compiler) visitContinueStmt(s *stmtContinue) completion {
+	l := c.loops[len(c.loops)-1]
+	top := c.exitTries(l.tries, s.line)
+	c.emitPops(top, l.locals, s.line)
+	l.continues = append(l.continues, c.emitJump(opJump, s.line))
+	return completion{}
+}
+
+// visitTryStmt installs a handler for the finally block around one for the
+// catch block. Errors leave the finally block with the error, and
+// completing the try and catch blocks enters it with nil.
+func (c *compiler) visitTryStmt(s *stmtTry) completion {
+	var fin *tryBlock
+	var finHandler int
+	if s.finallyBody != nil {
+		fin = &tryBlock{finally: true, locals: len(c.locals)}
+		finHandler = c.emitJump(opTryFinally, c.lastLine())
+		c.tries = append(c.tries, fin)
+	}
+	if s.catchBody == nil {
+		s.body.accept(c)
+	} else {
+		catchHandler := c.emitJump(opTry, c.lastLine())
+		c.tries = append(c.tries, &tryBlock{locals: len(c.locals)})
+		s.body.accept(c)
+		c.tries = c.tries[:len(c.tries)-1]
+		c.emitOp(opEndTry, s.catchName.line)
+		endJump := c.emitJump(opJump, s.catchName.line)
+		c.patchJump(catchHandler)
+		c.beginScope()
+		c.addLocal(s.catchName.lexeme, s.catchName.line)
+		c.statements(s.catchBody.(*stmtBlock).statements)
+		c.endScope(s.catchName.line)
+		c.patchJump(endJump)
+	}
+	if fin == nil {
+		return completion{}
+	}
+	line := c.lastLine()
+	c.tries = c.tries[:len(c.tries)-1]
+	c.emitOp(opEndTry, line)
+	c.emitOp(opNil, line)
+	c.patchJump(finHandler)
+	c.patchJumps(fin.exits)
+	c.beginScope()
+	c.addLocal(" finally", line)
+	s.finallyBody.accept(c)
+	c.emitOp(opEndFinally, line)
+	c.scopeDepth--
+	c.locals = c.locals[:len(c.locals)-1]
+	return completion{}
+}
+
+// lastLine is the line of the last instruction, which statements without a
+// token of their own use, or the line the function starts at.
+func (c *compiler) lastLine() int {
+	if len(c.chunk().lines) > 0 {
+		return c.chunk().lines[len(c.chunk().lines)-1]
+	}
+	return c.line
+}
+
+func (c *compiler) visitThrowStmt(s *stmtThrow) completion {
+	c.expression(s.value)
+	c.emitOp(opThrow, s.line)
+	return completion{}
+}
+
+func (c *compiler) visitYieldStmt(s *stmtYield) completion {
+	if s.value != nil {
+		c.expression(s.value)
+	} else {
+		c.emitOp(opNil, s.line)
+	}
+	c.emitOp(opYield, s.line)
+	// a generator closed while suspended here returns from the yield
+	resumeJump := c.emitJump(opJumpIfOpen, s.line)
+	c.emitOp(opNil, s.line)
+	c.returnValue(s.line)
+	c.patchJump(resumeJump)
+	return completion{}
+}
+
+func (c *compiler) visitImportStmt(s *stmtImport) completion {
+	c.emitConstant(opImport, s.path.literal, s.line)
+	if s.alias.lexeme != "" {
+		c.emitOp(opDup, s.line)
+		c.define(s.alias)
+	}
+	for _, name := range s.names {
+		c.emitOp(opDup, s.line)
+		c.emitConstant(opGetProperty, name.lexeme, name.line)
+		c.define(name)
+	}
+	c.emitOp(opPop, s.line)
+	return completion{}
+}
+
+func (c *compiler) visitExportStmt(s *stmtExport) completion {
+	s.declaration.accept(c)
+	c.emitConstant(opExport, s.name().lexeme, s.line)
+	return completion{}
+}
+
+func (c *compiler) visitBlockStmt(s *stmtBlock) completion {
+	c.beginScope()
+	c.statements(s.statements)
+	c.endScope(c.lastLine())
+	return completion{}
+}
+
+func (c *compiler) visitExprStmt(s *stmtExpr) completion {
+	c.expression(s.initializer)
+	c.emitOp(opPop, c.lastLine())
+	return completion{}
+}
+
+func (c *compiler) visitVar(e *expressionVar) (any, error) {
+	c.getVariable(e.lexeme(), e.token().line)
+	return nil, nil
+}
+
+func (c *compiler) visitAssignment(e *expressionAssignment) (any, error) {
+	c.expression(e.next())
+	c.setVariable(e.expr().lexeme(), e.expr().token().line)
+	return nil, nil
+}
+
+func (c *compiler) visitSet(e *expressionSet) (any, error) {
+	c.expression(e.expression)
+	c.expression(e.value)
+	c.emitNode(opSetProperty, e.expression, e.name.line)
+	c.emitShort(c.chunk().addConstant(e.name.lexeme), e.name.line)
+	return nil, nil
+}
+
+// visitCompound leaves the target on the stack below its old value, which is
+// buried under it for postfix increments.
+func (c *compiler) visitCompound(e *expressionCompound) (any, error) {
+	line := e.operator.line
+	switch target := e.expression.(type) {
+	case *expressionVar:
+		c.getVariable(target.lexeme(), target.token().line)
+		if e.postfix {
+			c.emitOp(opDup, line)
+		}
+		c.compoundOperation(e)
+		c.setVariable(target.lexeme(), line)
+	case *expressionGet:
+		c.expression(target.expression)
+		c.emitOp(opDup, line)
+		c.emitNode(opGetField, target.expression, target.name.line)
+		c.emitShort(c.chunk().addConstant(target.name.lexeme), target.name.line)
+		if e.postfix {
+			c.emitOp(opDup, line)
+			c.emit(line, byte(opBury), 2)
+		}
+		c.compoundOperation(e)
+		c.emitNode(opSetProperty, target.expression, target.name.line)
+		c.emitShort(c.chunk().addConstant(target.name.lexeme), target.name.line)
+	case *expressionIndex:
+		c.expression(target.expression)
+		c.expression(target.index)
+		c.emitOp(opDup2, line)
+		c.emitOp(opIndex, target.bracket.line)
+		if e.postfix {
+			c.emitOp(opDup, line)
+			c.emit(line, byte(opBury), 3)
+		}
+		c.compoundOperation(e)
+		c.emitOp(opSetIndex, target.bracket.line)
+	}
+	if e.postfix {
+		c.emitOp(opPop, line)
+	}
+	return nil, nil
+}
+
+// compoundOperation computes the new value of a compound assignment from the
+// old one on the stack.
+func (c *compiler) compoundOperation(e *expressionCompound) {
+	if e.value != nil {
+		c.expression(e.value)
+	} else {
+		c.emitConstant(opConstant, 1.0, e.operator.line)
+	}
+	c.emitNode(binaryOps[e.operation.tokenType()], e.operation, e.operator.line)
+}
+
+var binaryOps = map[string]opCode{
+	EQUAL_EQUAL:     opEqual,
+	BANG_EQUAL:      opNotEqual,
+	GREATER:         opGreater,
+	GREATER_EQUAL:   opGreaterEqual,
+	LESS:            opLess,
+	LESS_EQUAL:      opLessEqual,
+	PLUS:            opAdd,
+	MINUS:           opSubtract,
+	STAR:            opMultiply,
+	SLASH:           opDivide,
+	PERCENT:         opModulo,
+	TILDE_SLASH:     opIntDivide,
+	STAR_STAR:       opPower,
+	AMPERSAND:       opBitAnd,
+	PIPE:            opBitOr,
+	CARET:           opBitXor,
+	LESS_LESS:       opShiftLeft,
+	GREATER_GREATER: opShiftRight,
+}
+
+func (c *compiler) visitLogical(e *expressionLogical) (any, error) {
+	line := e.token().line
+	c.expression(e.expr())
+	var jump int
+	switch e.tokenType() {
+	case QUESTION_QUESTION:
+		jump = c.emitJump(opJumpIfNotNil, line)
+	case OR:
+		jump = c.emitJump(opJumpIfTrue, line)
+	default:
+		jump = c.emitJump(opJumpIfFalse, line)
+	}
+	c.emitOp(opPop, line)
+	c.expression(e.next())
+	c.patchJump(jump)
+	return nil, nil
+}
+
+func (c *compiler) binary(e expression) (any, error) {
+	c.expression(e.expr())
+	c.expression(e.next())
+	c.emitNode(binaryOps[e.tokenType()], e, e.token().line)
+	return nil, nil
+}
+
+func (c *compiler) visitEquality(e *expressionEquality) (any, error)     { return c.binary(e) }
+func (c *compiler) visitComparison(e *expressionComparison) (any, error) { return c.binary(e) }
+func (c *compiler) visitTerm(e *expressionTerm) (any, error)             { return c.binary(e) }
+func (c *compiler) visitFactor(e *expressionFactor) (any, error)         { return c.binary(e) }
+func (c *compiler) visitPower(e *expressionPower) (any, error)           { return c.binary(e) }
+func (c *compiler) visitBitwise(e *expressionBitwise) (any, error)       { return c.binary(e) }
+
+func (c *compiler) visitUnary(e *expressionUnary) (any, error) {
+	c.expression(e.next())
+	switch e.tokenType() {
+	case BANG:
+		c.emitOp(opNot, e.token().line)
+	case MINUS:
+		c.emitNode(opNegate, e, e.token().line)
+	case TILDE:
+		c.emitNode(opBitNot, e, e.token().line)
+	}
+	return nil, nil
+}
+
+func (c *compiler) visitGet(e *expressionGet) (any, error) {
+	c.expression(e.expression)
+	c.optional(e.optional, e.name.line)
+	c.emitNode(opGetProperty, e, e.name.line)
+	c.emitShort(c.chunk().addConstant(e.name.lexeme), e.name.line)
+	return nil, nil
+}
+
+// optional emits the jump to the end of the optional chain for a '?.' link.
+func (c *compiler) optional(optional bool, line int) {
+	if optional {
+		n := len(c.optionals) - 1
+		c.optionals[n] = append(c.optionals[n], c.emitJump(opJumpIfNil, line))
+	}
+}
+
+func (c *compiler) visitIndex(e *expressionIndex) (any, error) {
+	c.expression(e.expression)
+	c.optional(e.optional, e.bracket.line)
+	c.expression(e.index)
+	c.emitOp(opIndex, e.bracket.line)
+	return nil, nil
+}
+
+func (c *compiler) visitIndexSet(e *expressionIndexSet) (any, error) {
+	c.expression(e.expression)
+	c.expression(e.index)
+	c.expression(e.value)
+	c.emitOp(opSetIndex, e.bracket.line)
+	return nil, nil
+}
+
+func (c *compiler) visitCall(e *expressionCall) (any, error) {
+	line := e.token().line
+	if c.calls == 0 {
+		c.callLine = line
+	}
+	c.calls++
+	defer func() { c.calls-- }()
+	get, isGet := e.expression.(*expressionGet)
+	if isGet && !e.optional && !hasSpread(e.args) && len(e.args) < 256 {
+		// call the method without creating a bound method first
+		c.expression(get.expression)
+		c.optional(get.optional, get.name.line)
+		c.arguments(e.args, line)
+		c.emitNode(opInvoke, get, line)
+		c.emitShort(c.chunk().addConstant(get.name.lexeme), line)
+		c.emit(line, byte(len(e.args)))
+		return nil, nil
+	}
+	c.expression(e.expression)
+	c.optional(e.optional, line)
+	if hasSpread(e.args) || len(e.args) > 255 {
+		c.list(e.args, line)
+		c.emitOp(opCallList, line)
+		return nil, nil
+	}
+	c.arguments(e.args, line)
+	c.emit(line, byte(opCall), byte(len(e.args)))
+	return nil, nil
+}
+
+func hasSpread(exprs []expression) bool {
+	for _, e := range exprs {
+		if _, ok := e.(*expressionSpread); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *compiler) arguments(args []expression, line int) {
+	for _, arg := range args {
+		c.expression(arg)
+	}
+}
+
+// list emits a list of the values of exprs, expanding spread iterables.
+func (c *compiler) list(exprs []expression, line int) {
+	if !hasSpread(exprs) && len(exprs) <= 0xffff {
+		c.arguments(exprs, line)
+		c.emitOp(opList, line)
+		c.emitShort(len(exprs), line)
+		return
+	}
+	c.emitOp(opList, line)
+	c.emitShort(0, line)
+	for _, e := range exprs {
+		if spread, ok := e.(*expressionSpread); ok {
+			c.expression(spread.expr())
+			c.emitOp(opAppendSpread, spread.token().line)
+		} else {
+			c.expression(e)
+			c.emitOp(opAppend, line)
+		}
+	}
+}
+
+func (c *compiler) visitOptional(e *expressionOptional) (any, error) {
+	c.optionals = append(c.optionals, nil)
+	c.expression(e.expression)
+	n := len(c.optionals) - 1
+	c.patchJumps(c.optionals[n])
+	c.optionals = c.optionals[:n]
+	return nil, nil
+}
+
+func (c *compiler) visitTernary(e *expressionTernary) (any, error) {
+	line := e.token().line
+	c.expression(e.expr())
+	elseJump := c.emitJump(opJumpIfFalse, line)
+	c.emitOp(opPop, line)
+	c.expression(e.next())
+	endJump := c.emitJump(opJump, line)
+	c.patchJump(elseJump)
+	c.emitOp(opPop, line)
+	c.expression(e.elseBranch)
+	c.patchJump(endJump)
+	return nil, nil
+}
+
+func (c *compiler) visitLiteral(e *expressionLiteral) (any, error) {
+	line := e.token().line
+	switch value := e.value().(type) {
+	case nil:
+		c.emitOp(opNil, line)
+	case bool:
+		if value {
+			c.emitOp(opTrue, line)
+		} else {
+			c.emitOp(opFalse, line)
+		}
+	default:
+		c.emitConstant(opConstant, value, line)
+	}
+	return nil, nil
+}
+
+func (c *compiler) visitGroup(e *expressionGroup) (any, error) {
+	c.expression(e.expression)
+	return nil, nil
+}
+
+func (c *compiler) visitList(e *expressionList) (any, error) {
+	c.list(e.elements, e.token().line)
+	return nil, nil
+}
+
+func (c *compiler) visitMap(e *expressionMap) (any, error) {
+	line := e.token().line
+	c.emitOp(opMap, line)
+	for index, key := range e.keys {
+		c.expression(key)
+		c.expression(e.values[index])
+		c.emitOp(opMapSet, line)
+	}
+	return nil, nil
+}
+
+func (c *compiler) visitInterpolation(e *expressionInterpolation) (any, error) {
+	for _, part := range e.parts {
+		c.expression(part)
+	}
+	c.emitOp(opInterpolate, e.token().line)
+	c.emitShort(len(e.parts), e.token().line)
+	return nil, nil
+}
+
+func (c *compiler) visitSpread(e *expressionSpread) (any, error) {
+	message := "Can only spread in argument lists and lists."
+	c.emitConstant(opError, message, e.token().line)
+	return nil, nil
+}
+
+func (c *compiler) visitLambda(e *expressionLambda) (any, error) {
+	c.closure(e.function, function)
+	return nil, nil
+}
+
+func (c *compiler) visitSuper(e *expressionSuper) (any, error) {
+	c.getVariable("this", e.token().line)
+	c.getVariable("super", e.token().line)
+	c.emitConstant(opGetSuper, e.method.lexeme, e.method.line)
+	return nil, nil
+}
+
+func (c *compiler) visitThis(e *expressionThis) (any, error) {
+	c.getVariable("this", e.token().line)
+	return nil, nil
+}
+
+func (c *compiler) visitExpr(e *exp) (any, error) {
+	c.emitOp(opNil, e.token().line)
+	return nil, nil
+}
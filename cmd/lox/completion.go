@@ -0,0 +1,28 @@
+package lox
+
+// completionKind is how the execution of a statement ended.
+type completionKind int
+
+const (
+	normalCompletion completionKind = iota
+	returnCompletion
+	breakCompletion
+	continueCompletion
+	throwCompletion
+)
+
+// completion is the result of executing a statement. Return, break, continue
+// and throw complete abruptly, and so do the statements containing them up
+// to the function, loop or try statement that handles it.
+type completion struct {
+	kind completionKind
+	// value is the value of a return.
+	value any
+	// err is the error of a throw.
+	err loxError
+}
+
+// throw is the completion of a statement that raised the runtime error err.
+func throw(err error) completion {
+	return completion{kind: throwCompletion, err: err.(loxError)}
+}
@@ -1,45 +1,79 @@
 package lox
 
 const (
-	STRING     = "STRING"
-	IDENTIFIER = "IDENTIFIER"
-	NUMBER     = "NUMBER"
-	EOF        = "EOF"
-	NULL       = "null"
+	STRING        = "STRING"
+	INTERPOLATION = "INTERPOLATION"
+	IDENTIFIER    = "IDENTIFIER"
+	NUMBER        = "NUMBER"
+	EOF           = "EOF"
+	NULL          = "null"
 
-	AND    = "AND"
-	CLASS  = "CLASS"
-	ELSE   = "ELSE"
-	FALSE  = "FALSE"
-	FOR    = "FOR"
-	FUN    = "FUN"
-	IF     = "IF"
-	NIL    = "NIL"
-	OR     = "OR"
-	RETURN = "RETURN"
-	SUPER  = "SUPER"
-	THIS   = "THIS"
-	TRUE   = "TRUE"
-	VAR    = "VAR"
-	WHILE  = "WHILE"
+	AND      = "AND"
+	BREAK    = "BREAK"
+	CATCH    = "CATCH"
+	CLASS    = "CLASS"
+	CONTINUE = "CONTINUE"
+	ELSE     = "ELSE"
+	EXPORT   = "EXPORT"
+	FALSE    = "FALSE"
+	FINALLY  = "FINALLY"
+	FOR      = "FOR"
+	FUN      = "FUN"
+	IF       = "IF"
+	IMPORT   = "IMPORT"
+	NIL      = "NIL"
+	OR       = "OR"
+	RETURN   = "RETURN"
+	SUPER    = "SUPER"
+	THIS     = "THIS"
+	THROW    = "THROW"
+	TRUE     = "TRUE"
+	TRY      = "TRY"
+	VAR      = "VAR"
+	WHILE    = "WHILE"
+	YIELD    = "YIELD"
 
-	EQUAL_EQUAL   = "EQUAL_EQUAL"
-	BANG_EQUAL    = "BANG_EQUAL"
-	GREATER_EQUAL = "GREATER_EQUAL"
-	LESS_EQUAL    = "LESS_EQUAL"
-	GREATER       = "GREATER"
-	LESS          = "LESS"
-	BANG          = "BANG"
-	EQUAL         = "EQUAL"
-	SEMICOLON     = "SEMICOLON"
-	LEFT_PAREN    = "LEFT_PAREN"
-	RIGHT_PAREN   = "RIGHT_PAREN"
-	LEFT_BRACE    = "LEFT_BRACE"
-	RIGHT_BRACE   = "RIGHT_BRACE"
-	STAR          = "STAR"
-	DOT           = "DOT"
-	COMMA         = "COMMA"
-	PLUS          = "PLUS"
-	MINUS         = "MINUS"
-	SLASH         = "SLASH"
+	EQUAL_EQUAL       = "EQUAL_EQUAL"
+	BANG_EQUAL        = "BANG_EQUAL"
+	GREATER_EQUAL     = "GREATER_EQUAL"
+	LESS_EQUAL        = "LESS_EQUAL"
+	GREATER           = "GREATER"
+	LESS              = "LESS"
+	BANG              = "BANG"
+	EQUAL             = "EQUAL"
+	ARROW             = "ARROW"
+	QUESTION          = "QUESTION"
+	QUESTION_QUESTION = "QUESTION_QUESTION"
+	QUESTION_DOT      = "QUESTION_DOT"
+	SEMICOLON         = "SEMICOLON"
+	LEFT_PAREN        = "LEFT_PAREN"
+	RIGHT_PAREN       = "RIGHT_PAREN"
+	LEFT_BRACE        = "LEFT_BRACE"
+	RIGHT_BRACE       = "RIGHT_BRACE"
+	LEFT_BRACKET      = "LEFT_BRACKET"
+	RIGHT_BRACKET     = "RIGHT_BRACKET"
+	STAR              = "STAR"
+	DOT               = "DOT"
+	DOT_DOT_DOT       = "DOT_DOT_DOT"
+	COMMA             = "COMMA"
+	COLON             = "COLON"
+	PLUS              = "PLUS"
+	MINUS             = "MINUS"
+	SLASH             = "SLASH"
+	STAR_STAR         = "STAR_STAR"
+	PERCENT           = "PERCENT"
+	TILDE_SLASH       = "TILDE_SLASH"
+	TILDE             = "TILDE"
+	AMPERSAND         = "AMPERSAND"
+	PIPE              = "PIPE"
+	CARET             = "CARET"
+	LESS_LESS         = "LESS_LESS"
+	GREATER_GREATER   = "GREATER_GREATER"
+	PLUS_EQUAL        = "PLUS_EQUAL"
+	MINUS_EQUAL       = "MINUS_EQUAL"
+	STAR_EQUAL        = "STAR_EQUAL"
+	SLASH_EQUAL       = "SLASH_EQUAL"
+	PERCENT_EQUAL     = "PERCENT_EQUAL"
+	PLUS_PLUS         = "PLUS_PLUS"
+	MINUS_MINUS       = "MINUS_MINUS"
 )
@@ -0,0 +1,234 @@
+package lox
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var opNames = [...]string{
+	opConstant:      "OP_CONSTANT",
+	opNil:           "OP_NIL",
+	opTrue:          "OP_TRUE",
+	opFalse:         "OP_FALSE",
+	opPop:           "OP_POP",
+	opDup:           "OP_DUP",
+	opDup2:          "OP_DUP2",
+	opBury:          "OP_BURY",
+	opGetLocal:      "OP_GET_LOCAL",
+	opSetLocal:      "OP_SET_LOCAL",
+	opGetGlobal:     "OP_GET_GLOBAL",
+	opSetGlobal:     "OP_SET_GLOBAL",
+	opDefineGlobal:  "OP_DEFINE_GLOBAL",
+	opGetUpvalue:    "OP_GET_UPVALUE",
+	opSetUpvalue:    "OP_SET_UPVALUE",
+	opCloseUpvalue:  "OP_CLOSE_UPVALUE",
+	opGetProperty:   "OP_GET_PROPERTY",
+	opGetField:      "OP_GET_FIELD",
+	opSetProperty:   "OP_SET_PROPERTY",
+	opGetSuper:      "OP_GET_SUPER",
+	opIndex:         "OP_INDEX",
+	opSetIndex:      "OP_SET_INDEX",
+	opEqual:         "OP_EQUAL",
+	opNotEqual:      "OP_NOT_EQUAL",
+	opGreater:       "OP_GREATER",
+	opGreaterEqual:  "OP_GREATER_EQUAL",
+	opLess:          "OP_LESS",
+	opLessEqual:     "OP_LESS_EQUAL",
+	opAdd:           "OP_ADD",
+	opSubtract:      "OP_SUBTRACT",
+	opMultiply:      "OP_MULTIPLY",
+	opDivide:        "OP_DIVIDE",
+	opModulo:        "OP_MODULO",
+	opIntDivide:     "OP_INT_DIVIDE",
+	opPower:         "OP_POWER",
+	opBitAnd:        "OP_BIT_AND",
+	opBitOr:         "OP_BIT_OR",
+	opBitXor:        "OP_BIT_XOR",
+	opShiftLeft:     "OP_SHIFT_LEFT",
+	opShiftRight:    "OP_SHIFT_RIGHT",
+	opBitNot:        "OP_BIT_NOT",
+	opNot:           "OP_NOT",
+	opNegate:        "OP_NEGATE",
+	opJump:          "OP_JUMP",
+	opJumpIfFalse:   "OP_JUMP_IF_FALSE",
+	opJumpIfTrue:    "OP_JUMP_IF_TRUE",
+	opJumpIfNil:     "OP_JUMP_IF_NIL",
+	opJumpIfNotNil:  "OP_JUMP_IF_NOT_NIL",
+	opJumpIfArg:     "OP_JUMP_IF_ARG",
+	opLoop:          "OP_LOOP",
+	opCall:          "OP_CALL",
+	opInvoke:        "OP_INVOKE",
+	opCallList:      "OP_CALL_LIST",
+	opClosure:       "OP_CLOSURE",
+	opReturn:        "OP_RETURN",
+	opStash:         "OP_STASH",
+	opReturnStashed: "OP_RETURN_STASHED",
+	opClass:         "OP_CLASS",
+	opSuperclass:    "OP_SUPERCLASS",
+	opMethod:        "OP_METHOD",
+	opStaticMethod:  "OP_STATIC_METHOD",
+	opStaticField:   "OP_STATIC_FIELD",
+	opList:          "OP_LIST",
+	opAppend:        "OP_APPEND",
+	opAppendSpread:  "OP_APPEND_SPREAD",
+	opMap:           "OP_MAP",
+	opMapSet:        "OP_MAP_SET",
+	opInterpolate:   "OP_INTERPOLATE",
+	opIter:          "OP_ITER",
+	opForNext:       "OP_FOR_NEXT",
+	opCloseIter:     "OP_CLOSE_ITER",
+	opTry:           "OP_TRY",
+	opTryFinally:    "OP_TRY_FINALLY",
+	opEndTry:        "OP_END_TRY",
+	opFinallyJump:   "OP_FINALLY_JUMP",
+	opEndFinally:    "OP_END_FINALLY",
+	opThrow:         "OP_THROW",
+	opYield:         "OP_YIELD",
+	opJumpIfOpen:    "OP_JUMP_IF_OPEN",
+	opImport:        "OP_IMPORT",
+	opExport:        "OP_EXPORT",
+	opError:         "OP_ERROR",
+}
+
+func (op opCode) String() string {
+	if int(op) < len(opNames) {
+		return opNames[op]
+	}
+	return fmt.Sprintf("OP_UNKNOWN(%d)", byte(op))
+}
+
+// disassembler prints the instructions of compiled functions.
+type disassembler struct {
+	out io.Writer
+}
+
+// function prints the instructions of f followed by those of the functions
+// declared in it.
+func (d *disassembler) function(f *vmFunction) {
+	fmt.Fprintf(d.out, "== %s ==\n", f)
+	for offset := 0; offset < len(f.chunk.code); {
+		offset = d.instruction(f.chunk, offset)
+	}
+	for _, constant := range f.chunk.constants {
+		if function, ok := constant.(*vmFunction); ok {
+			fmt.Fprintln(d.out)
+			d.function(function)
+		}
+	}
+}
+
+// instruction prints the instruction at offset and returns the offset of
+// the next one. Jumps show their target and constants their value.
+func (d *disassembler) instruction(c *chunk, offset int) int {
+	fmt.Fprintf(d.out, "%04d ", offset)
+	if offset > 0 && c.lines[offset] == c.lines[offset-1] {
+		fmt.Fprint(d.out, "   | ")
+	} else {
+		fmt.Fprintf(d.out, "%4d ", c.lines[offset])
+	}
+	op := opCode(c.code[offset])
+	switch op {
+	case opConstant, opGetGlobal, opSetGlobal, opDefineGlobal, opGetProperty, opGetField,
+		opSetProperty, opGetSuper, opMethod, opStaticMethod, opStaticField, opImport, opExport, opError:
+		index := c.readShort(offset + 1)
+		fmt.Fprintf(d.out, "%-20s %4d %s\n", op, index, debugString(c.constants[index]))
+		return offset + 3
+	case opGetLocal, opSetLocal, opGetUpvalue, opSetUpvalue, opCall, opBury, opCloseIter:
+		fmt.Fprintf(d.out, "%-20s %4d\n", op, c.code[offset+1])
+		return offset + 2
+	case opList, opInterpolate:
+		fmt.Fprintf(d.out, "%-20s %4d\n", op, c.readShort(offset+1))
+		return offset + 3
+	case opJump, opJumpIfFalse, opJumpIfTrue, opJumpIfNil, opJumpIfNotNil, opTry, opTryFinally, opFinallyJump,
+		opJumpIfOpen:
+		fmt.Fprintf(d.out, "%-20s %4d -> %d\n", op, offset, offset+3+c.readShort(offset+1))
+		return offset + 3
+	case opLoop:
+		fmt.Fprintf(d.out, "%-20s %4d -> %d\n", op, offset, offset+3-c.readShort(offset+1))
+		return offset + 3
+	case opJumpIfArg, opForNext:
+		target := offset + 4 + c.readShort(offset+2)
+		fmt.Fprintf(d.out, "%-20s %4d -> %d\n", op, c.code[offset+1], target)
+		return offset + 4
+	case opInvoke:
+		index := c.readShort(offset + 1)
+		name := debugString(c.constants[index])
+		fmt.Fprintf(d.out, "%-20s (%d args) %4d %s\n", op, c.code[offset+3], index, name)
+		return offset + 4
+	case opClass:
+		index := c.readShort(offset + 1)
+		name := debugString(c.constants[index])
+		if c.code[offset+3] == 1 {
+			name += " < super"
+		}
+		fmt.Fprintf(d.out, "%-20s %4d %s\n", op, index, name)
+		return offset + 4
+	case opClosure:
+		index := c.readShort(offset + 1)
+		function := c.constants[index].(*vmFunction)
+		fmt.Fprintf(d.out, "%-20s %4d %s\n", op, index, function)
+		offset += 3
+		for n := 0; n < function.upvalueCount; n++ {
+			kind := "upvalue"
+			if c.code[offset] == 1 {
+				kind = "local"
+			}
+			fmt.Fprintf(d.out, "%04d    |                      %s %d\n", offset, kind, c.code[offset+1])
+			offset += 2
+		}
+		return offset
+	}
+	fmt.Fprintln(d.out, op)
+	return offset + 1
+}
+
+// debugString formats values for the disassembler and the trace without
+// running Lox code, unlike stringify.
+func debugString(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return "nil"
+	case string:
+		return strconv.Quote(value)
+	case float64, bool:
+		return fmt.Sprint(value)
+	case *loxList:
+		return fmt.Sprintf("<list of %d>", len(value.elements))
+	case *loxMap:
+		return fmt.Sprintf("<map of %d>", len(value.keys))
+	case fmt.Stringer:
+		return value.String()
+	case iterator:
+		return "<iterator>"
+	case finallyJump:
+		return fmt.Sprintf("<finally jump %d>", int(value))
+	case finallyThrow:
+		return "<finally throw>"
+	}
+	return fmt.Sprintf("<%T>", value)
+}
+
+// traceOutput receives the trace of the VMs created after it is enabled.
+var traceOutput io.Writer
+
+// EnableTrace makes the VM print every instruction it executes to stderr,
+// after the values on the stack of the function executing it.
+func EnableTrace() {
+	traceOutput = os.Stderr
+}
+
+// traceInstruction prints the stack of the current frame and the instruction
+// it executes next.
+func (vm *vm) traceInstruction(frame *vmFrame) {
+	var b strings.Builder
+	b.WriteString("          ")
+	for _, value := range vm.fiber.stack[frame.slots:] {
+		b.WriteString("[ " + debugString(value) + " ]")
+	}
+	fmt.Fprintln(vm.trace, b.String())
+	d := disassembler{vm.trace}
+	d.instruction(frame.closure.function.chunk, frame.ip)
+}
@@ -4,51 +4,43 @@ import (
 	"fmt"
 )
 
+// environment holds the local variables of a scope in the slots the resolver
+// assigned to them, in the order they are declared. The root environment of
+// a module has no slots, its variables are in the global table.
 type environment struct {
 	enclosing *environment
-	values    map[string]any
+	values    []any
+	globals   *globalTable
 }
 
-func newEnvironment(env *environment) *environment {
-	return &environment{env, make(map[string]any)}
+// newEnvironment returns the environment of a scope declaring size
+// variables, whose slots are allocated up front.
+func newEnvironment(env *environment, size int) *environment {
+	return &environment{env, make([]any, 0, size), env.globals}
 }
 
-func (e *environment) define(name string, value any) {
-	e.values[name] = value
+// newGlobalEnvironment returns the root environment for the top-level code
+// of a module with the given globals.
+func newGlobalEnvironment(globals *globalTable) *environment {
+	return &environment{nil, nil, globals}
 }
 
-func (e *environment) assign(t token, value any) {
-	_, ok := e.values[t.lexeme]
-	if ok {
-		e.values[t.lexeme] = value
-		return
-	}
-	if e.enclosing != nil {
-		e.enclosing.assign(t, value)
+// define declares a variable in the next slot, which newEnvironment already
+// allocated, or as a global in the root environment.
+func (e *environment) define(name string, value any) {
+	if e.enclosing == nil {
+		e.globals.define(name, value)
 		return
 	}
-	err := newError(fmt.Sprintf("Undefined variable %s.", t.lexeme), t.line)
-	panic(err)
-}
-
-func (e *environment) assignAt(distance int, token token, value any) {
-	e.ancestor(distance).assign(token, value)
+	e.values = append(e.values, value)
 }
 
-func (e *environment) get(t token) any {
-	value, ok := e.values[t.lexeme]
-	if ok {
-		return value
-	}
-	if e.enclosing != nil {
-		return e.enclosing.get(t)
-	}
-	err := newError(fmt.Sprintf("Undefined variable %s.", t.lexeme), t.line)
-	panic(err)
+func (e *environment) getAt(distance int, slot int) any {
+	return e.ancestor(distance).values[slot]
 }
 
-func (e *environment) getAt(distance int, token token) any {
-	return e.ancestor(distance).get(token)
+func (e *environment) assignAt(distance int, slot int, value any) {
+	e.ancestor(distance).values[slot] = value
 }
 
 func (e *environment) ancestor(distance int) *environment {
@@ -58,3 +50,37 @@ func (e *environment) ancestor(distance int) *environment {
 	}
 	return env
 }
+
+// globalTable holds the variables declared at the top level of a module.
+// Names that aren't declared in it are looked up in the builtins.
+type globalTable struct {
+	builtins *globalTable
+	values   map[string]any
+}
+
+func newGlobalTable(builtins *globalTable) *globalTable {
+	return &globalTable{builtins, make(map[string]any)}
+}
+
+func (g *globalTable) define(name string, value any) {
+	g.values[name] = value
+}
+
+func (g *globalTable) get(t token) (any, error) {
+	for table := g; table != nil; table = table.builtins {
+		if value, ok := table.values[t.lexeme]; ok {
+			return value, nil
+		}
+	}
+	return nil, newError(fmt.Sprintf("Undefined variable %s.", t.lexeme), t.line)
+}
+
+func (g *globalTable) assign(t token, value any) error {
+	for table := g; table != nil; table = table.builtins {
+		if _, ok := table.values[t.lexeme]; ok {
+			table.values[t.lexeme] = value
+			return nil
+		}
+	}
+	return newError(fmt.Sprintf("Undefined variable %s.", t.lexeme), t.line)
+}
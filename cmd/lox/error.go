@@ -5,12 +5,35 @@ import "fmt"
 type loxError struct {
 	message string
 	line    int
+	// value is the Lox value that was thrown or the error object of a
+	// runtime error once it passed a function call.
+	value any
+	// thrown is set for errors raised by a throw statement, whose value can
+	// be nil, and unset for runtime errors.
+	thrown bool
+}
+
+// hasValue reports whether the error was thrown or already has the error
+// object of its runtime error.
+func (e loxError) hasValue() bool {
+	return e.thrown || e.value != nil
 }
 
 func newError(message string, line int) loxError {
 	return loxError{message: message, line: line}
 }
 
+func (e loxError) Error() string {
+	return e.String()
+}
+
 func (e loxError) String() string {
 	return fmt.Sprintf("[line %d] Error: %s", e.line, e.message)
 }
+
+// atLine returns the runtime error err as raised at line.
+func atLine(err error, line int) error {
+	e := err.(loxError)
+	e.line = line
+	return e
+}
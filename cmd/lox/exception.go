@@ -0,0 +1,65 @@
+package lox
+
+import (
+	"fmt"
+	"strings"
+)
+
+// errorClassSource defines the class of the error objects that runtime
+// errors are turned into when they are caught.
+const errorClassSource = `
+class Error {
+  init(message) {
+    this.message = message;
+    this.line = nil;
+    this.stack = nil;
+  }
+}
+`
+
+type callFrame struct {
+	function string
+	line     int
+}
+
+func (i *interpreter) defineErrorClass() {
+	p := newParser(errorClassSource)
+	stmts, _ := p.parse()
+	i.resolver.resolve(stmts)
+	i.interpret(stmts)
+	i.errorClass = i.builtins.values["Error"].(*loxClass)
+}
+
+func (i *interpreter) errorObject(message string, line int) *loxInstance {
+	fields := map[string]any{
+		"message": message,
+		"line":    float64(line),
+		"stack":   i.stackTrace(line),
+	}
+	return &loxInstance{i.errorClass, fields}
+}
+
+func (i *interpreter) isErrorObject(value any) (*loxInstance, bool) {
+	instance, ok := value.(*loxInstance)
+	if !ok {
+		return nil, false
+	}
+	for class := instance.class; class != nil; class = class.superclass {
+		if class == i.errorClass {
+			return instance, true
+		}
+	}
+	return nil, false
+}
+
+// stackTrace lists the active calls, starting with the innermost one which is
+// currently at the given line.
+func (i *interpreter) stackTrace(line int) string {
+	trace := []string{}
+	for n := len(i.frames) - 1; n >= 0; n-- {
+		trace = append(trace, fmt.Sprintf("at %s [line %d]", i.frames[n].function, line))
+		line = i.frames[n].line
+	}
+	trace = append(trace, fmt.Sprintf("at <script> [line %d]", line))
+	return strings.Join(trace, "\n")
+}
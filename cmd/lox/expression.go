@@ -1,7 +1,7 @@
 package lox
 
 type expression interface {
-	accept(v expressionVisitor) any
+	accept(v expressionVisitor) (any, error)
 	expr() expression
 	next() expression
 	token() token
@@ -18,6 +18,28 @@ type expressionAssignment struct {
 	expression
 }
 
+// expressionCompound is a compound assignment like 'a += 1' or an
+// increment/decrement like '++a' and 'a--', which have no value expression.
+type expressionCompound struct {
+	expression
+	operator token
+	value    expression
+	postfix  bool
+	// operation is the binary expression computing the new value of the
+	// target, whose operands stand for the old value and the value, or 1.
+	operation expression
+}
+
+var compoundOperators = map[string]string{
+	PLUS_EQUAL:    PLUS,
+	MINUS_EQUAL:   MINUS,
+	STAR_EQUAL:    STAR,
+	SLASH_EQUAL:   SLASH,
+	PERCENT_EQUAL: PERCENT,
+	PLUS_PLUS:     PLUS,
+	MINUS_MINUS:   MINUS,
+}
+
 type expressionSet struct {
 	expression
 	value expression
@@ -44,18 +66,53 @@ type expressionFactor struct {
 	expression
 }
 
+type expressionPower struct {
+	expression
+}
+
+type expressionBitwise struct {
+	expression
+}
+
 type expressionUnary struct {
 	expression
 }
 
 type expressionGet struct {
 	expression
-	name token
+	name     token
+	optional bool
+}
+
+type expressionIndex struct {
+	expression
+	index    expression
+	bracket  token
+	optional bool
+}
+
+type expressionIndexSet struct {
+	expression
+	index   expression
+	value   expression
+	bracket token
 }
 
 type expressionCall struct {
 	expression
-	args []expression
+	args     []expression
+	optional bool
+}
+
+// expressionOptional wraps a chain of property accesses, calls and indices
+// containing a '?.', which evaluates to nil as soon as a '?.' finds nil.
+type expressionOptional struct {
+	expression
+}
+
+type expressionTernary struct {
+	expression
+	elseBranch expression
 }
 
 type expressionLiteral struct {
@@ -67,68 +124,185 @@ type expressionGroup struct {
 	expression
 }
 
+type expressionList struct {
+	expression
+	elements []expression
+}
+
+type expressionMap struct {
+	expression
+	keys   []expression
+	values []expression
+}
+
+type expressionInterpolation struct {
+	expression
+	parts []expression
+}
+
+// expressionSpread passes the values of an iterable as separate arguments or
+// list elements.
+type expressionSpread struct {
+	expression
+}
+
+type expressionLambda struct {
+	expression
+	function *stmtFun
+}
+
+type expressionSuper struct {
+	expression
+	method token
+}
+
+type expressionThis struct {
+	expression
+}
+
 type exp struct {
 	expression expression
 	right      expression
 	operator   token
 }
 
-func (e *expressionVar) accept(v expressionVisitor) any {
+func (e *expressionVar) accept(v expressionVisitor) (any, error) {
 	return v.visitVar(e)
 }
 
-func (e *expressionAssignment) accept(v expressionVisitor) any {
+func (e *expressionAssignment) accept(v expressionVisitor) (any, error) {
 	return v.visitAssignment(e)
 }
 
-func (e *expressionLogical) accept(v expressionVisitor) any {
+func (e *expressionCompound) accept(v expressionVisitor) (any, error) {
+	return v.visitCompound(e)
+}
+
+func (e *expressionLogical) accept(v expressionVisitor) (any, error) {
 	return v.visitLogical(e)
 }
 
-func (e *expressionEquality) accept(v expressionVisitor) any {
+func (e *expressionEquality) accept(v expressionVisitor) (any, error) {
 	return v.visitEquality(e)
 }
 
-func (e *expressionComparison) accept(v expressionVisitor) any {
+func (e *expressionComparison) accept(v expressionVisitor) (any, error) {
 	return v.visitComparison(e)
 }
 
-func (e *expressionTerm) accept(v expressionVisitor) any {
+func (e *expressionTerm) accept(v expressionVisitor) (any, error) {
 	return v.visitTerm(e)
 }
 
-func (e *expressionFactor) accept(v expressionVisitor) any {
+func (e *expressionFactor) accept(v expressionVisitor) (any, error) {
 	return v.visitFactor(e)
 }
 
-func (e *expressionGet) accept(v expressionVisitor) any {
+func (e *expressionPower) accept(v expressionVisitor) (any, error) {
+	return v.visitPower(e)
+}
+
+func (e *expressionBitwise) accept(v expressionVisitor) (any, error) {
+	return v.visitBitwise(e)
+}
+
+func (e *expressionGet) accept(v expressionVisitor) (any, error) {
 	return v.visitGet(e)
 }
 
-func (e *expressionSet) accept(v expressionVisitor) any {
+func (e *expressionSet) accept(v expressionVisitor) (any, error) {
 	return v.visitSet(e)
 }
 
-func (e *expressionCall) accept(v expressionVisitor) any {
+func (e *expressionIndex) accept(v expressionVisitor) (any, error) {
+	return v.visitIndex(e)
+}
+
+func (e *expressionIndexSet) accept(v expressionVisitor) (any, error) {
+	return v.visitIndexSet(e)
+}
+
+func (e *expressionCall) accept(v expressionVisitor) (any, error) {
 	return v.visitCall(e)
 }
 
-func (e *expressionUnary) accept(v expressionVisitor) any {
+func (e *expressionOptional) accept(v expressionVisitor) (any, error) {
+	return v.visitOptional(e)
+}
+
+func (e *expressionTernary) accept(v expressionVisitor) (any, error) {
+	return v.visitTernary(e)
+}
+
+func (e *expressionUnary) accept(v expressionVisitor) (any, error) {
 	return v.visitUnary(e)
 }
 
-func (e *expressionLiteral) accept(v expressionVisitor) any {
+func (e *expressionLiteral) accept(v expressionVisitor) (any, error) {
 	return v.visitLiteral(e)
 }
 
-func (e *expressionGroup) accept(v expressionVisitor) any {
+func (e *expressionGroup) accept(v expressionVisitor) (any, error) {
 	return v.visitGroup(e)
 }
 
-func (e *exp) accept(v expressionVisitor) any {
+func (e *expressionList) accept(v expressionVisitor) (any, error) {
+	return v.visitList(e)
+}
+
+func (e *expressionMap) accept(v expressionVisitor) (any, error) {
+	return v.visitMap(e)
+}
+
+func (e *expressionInterpolation) accept(v expressionVisitor) (any, error) {
+	return v.visitInterpolation(e)
+}
+
+func (e *expressionSpread) accept(v expressionVisitor) (any, error) {
+	return v.visitSpread(e)
+}
+
+func (e *expressionLambda) accept(v expressionVisitor) (any, error) {
+	return v.visitLambda(e)
+}
+
+func (e *expressionSuper) accept(v expressionVisitor) (any, error) {
+	return v.visitSuper(e)
+}
+
+func (e *expressionThis) accept(v expressionVisitor) (any, error) {
+	return v.visitThis(e)
+}
+
+func (e *exp) accept(v expressionVisitor) (any, error) {
 	return v.visitExpr(e)
 }
 
+func newCompound(target expression, operator token, value expression, postfix bool) *expressionCompound {
+	left := &expressionLiteral{&exp{nil, nil, target.token()}, nil}
+	right := value
+	if right == nil {
+		one := newToken(NUMBER, "1", "1.0", operator.line)
+		right = &expressionLiteral{&exp{nil, nil, one}, 1.0}
+	}
+	operatorType := compoundOperators[operator.tokenType]
+	binary := &exp{left, right, newToken(operatorType, operator.lexeme[:1], NULL, operator.line)}
+	var operation expression = &expressionFactor{binary}
+	if operatorType == PLUS || operatorType == MINUS {
+		operation = &expressionTerm{binary}
+	}
+	return &expressionCompound{target, operator, value, postfix, operation}
+}
+
+// result is the value of the compound expression: the old value of the
+// target for postfix increments and the new one otherwise.
+func (e *expressionCompound) result(old any, new any) any {
+	if e.postfix {
+		return old
+	}
+	return new
+}
+
 func (e *expressionLiteral) value() any {
 	return e.val
 }
@@ -1,18 +1,32 @@
 package lox
 
 type expressionVisitor interface {
-	visitVar(expr *expressionVar) any
-	visitAssignment(expr *expressionAssignment) any
-	visitSet(expr *expressionSet) any
-	visitLogical(expr *expressionLogical) any
-	visitEquality(expr *expressionEquality) any
-	visitComparison(expr *expressionComparison) any
-	visitTerm(expr *expressionTerm) any
-	visitFactor(expr *expressionFactor) any
-	visitUnary(expr *expressionUnary) any
-	visitGet(expr *expressionGet) any
-	visitCall(expr *expressionCall) any
-	visitLiteral(expr *expressionLiteral) any
-	visitGroup(expr *expressionGroup) any
-	visitExpr(expr *exp) any
+	visitVar(expr *expressionVar) (any, error)
+	visitAssignment(expr *expressionAssignment) (any, error)
+	visitSet(expr *expressionSet) (any, error)
+	visitCompound(expr *expressionCompound) (any, error)
+	visitLogical(expr *expressionLogical) (any, error)
+	visitEquality(expr *expressionEquality) (any, error)
+	visitComparison(expr *expressionComparison) (any, error)
+	visitTerm(expr *expressionTerm) (any, error)
+	visitFactor(expr *expressionFactor) (any, error)
+	visitPower(expr *expressionPower) (any, error)
+	visitBitwise(expr *expressionBitwise) (any, error)
+	visitUnary(expr *expressionUnary) (any, error)
+	visitGet(expr *expressionGet) (any, error)
+	visitIndex(expr *expressionIndex) (any, error)
+	visitIndexSet(expr *expressionIndexSet) (any, error)
+	visitCall(expr *expressionCall) (any, error)
+	visitOptional(expr *expressionOptional) (any, error)
+	visitTernary(expr *expressionTernary) (any, error)
+	visitLiteral(expr *expressionLiteral) (any, error)
+	visitGroup(expr *expressionGroup) (any, error)
+	visitList(expr *expressionList) (any, error)
+	visitMap(expr *expressionMap) (any, error)
+	visitInterpolation(expr *expressionInterpolation) (any, error)
+	visitSpread(expr *expressionSpread) (any, error)
+	visitLambda(expr *expressionLambda) (any, error)
+	visitSuper(expr *expressionSuper) (any, error)
+	visitThis(expr *expressionThis) (any, error)
+	visitExpr(expr *exp) (any, error)
 }
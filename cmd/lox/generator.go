@@ -0,0 +1,234 @@
+package lox
+
+import (
+	"fmt"
+	"runtime"
+	"slices"
+)
+
+// loxGenerator is returned by calling a function containing 'yield'. The
+// body of the function runs in its own goroutine, which takes turns with the
+// caller: next() resumes it and waits until it yields or returns.
+type loxGenerator struct {
+	function *loxFunction
+	args     []any
+	resume   chan []callFrame
+	closing  chan []callFrame
+	results  chan generatorResult
+	stop     chan struct{}
+	value    any
+	buffered bool
+	started  bool
+	running  bool
+	done     bool
+}
+
+type generatorResult struct {
+	value any
+	done  bool
+	// err is the runtime error raised by the body.
+	err error
+}
+
+// generatorContext is the part of a generator the goroutine running its
+// body knows about. It must not reference the loxGenerator, which would
+// otherwise never become unreachable.
+type generatorContext struct {
+	resume  chan []callFrame
+	closing chan []callFrame
+	results chan generatorResult
+	stop    chan struct{}
+	base    int
+	closed  bool
+}
+
+// generatorAbandoned unwinds the body of a generator that was garbage
+// collected before it finished. Unlike closing it, this doesn't run the
+// finally blocks, which would run Lox code concurrently with the caller.
+type generatorAbandoned struct{}
+
+// generator is the interface the generators of both engines share with their
+// methods and for-in loops.
+type generator interface {
+	hasNext(i *interpreter, t token) (bool, error)
+	next(i *interpreter, t token) (any, error)
+	close(i *interpreter, t token) error
+}
+
+type generatorMethod struct {
+	function func(*interpreter, generator, token) (any, error)
+}
+
+var generatorMethods = map[string]generatorMethod{
+	"next":    {function: generatorNext},
+	"hasNext": {function: generatorHasNext},
+}
+
+func newGenerator(f *loxFunction, args []any) *loxGenerator {
+	g := &loxGenerator{
+		function: f,
+		args:     args,
+		resume:   make(chan []callFrame),
+		closing:  make(chan []callFrame),
+		results:  make(chan generatorResult),
+		stop:     make(chan struct{}),
+	}
+	runtime.SetFinalizer(g, func(g *loxGenerator) {
+		if g.started && !g.done {
+			close(g.stop)
+		}
+	})
+	return g
+}
+
+func (g *loxGenerator) String() string {
+	return "<generator " + g.function.declaration.name.lexeme + ">"
+}
+
+func (g *loxGenerator) get(name token) (any, error) {
+	return generatorGet(g, name)
+}
+
+func generatorGet(g generator, name token) (any, error) {
+	m, ok := generatorMethods[name.lexeme]
+	if !ok {
+		return nil, newError(fmt.Sprintf("Undefined property '%s'.", name.lexeme), name.line)
+	}
+	function := func(i *interpreter, _ []any, t token) (any, error) {
+		return m.function(i, g, t)
+	}
+	return &builtin{function: function}, nil
+}
+
+func (g *loxGenerator) hasNext(i *interpreter, t token) (bool, error) {
+	err := g.advance(i, t)
+	return g.buffered, err
+}
+
+func (g *loxGenerator) next(i *interpreter, t token) (any, error) {
+	if err := g.advance(i, t); err != nil {
+		return nil, err
+	}
+	if !g.buffered {
+		return nil, newError("Generator has no more values.", t.line)
+	}
+	g.buffered = false
+	return g.value, nil
+}
+
+// advance runs the body until the next yield unless a value is buffered.
+// Errors in the body are returned to the caller.
+func (g *loxGenerator) advance(i *interpreter, t token) error {
+	if g.buffered || g.done {
+		return nil
+	}
+	if g.running {
+		return newError("Generator is already running.", t.line)
+	}
+	if !g.started {
+		g.started = true
+		g.start(i, t)
+	}
+	g.running = true
+	g.resume <- i.frames
+	r := <-g.results
+	g.running = false
+	if r.done {
+		g.done = true
+		return r.err
+	}
+	g.value, g.buffered = r.value, true
+	return nil
+}
+
+// close ends a generator suspended at a yield. The yield returns, so the
+// finally blocks around it run, and the errors they raise are returned.
+func (g *loxGenerator) close(i *interpreter, t token) error {
+	if g.done {
+		return nil
+	}
+	if g.running {
+		return newError("Generator is already running.", t.line)
+	}
+	g.done, g.buffered = true, false
+	if !g.started {
+		return nil
+	}
+	g.running = true
+	g.closing <- i.frames
+	r := <-g.results
+	g.running = false
+	return r.err
+}
+
+func (g *loxGenerator) start(i *interpreter, t token) {
+	context := &generatorContext{resume: g.resume, closing: g.closing, results: g.results, stop: g.stop}
+	// the body gets its own copy of the interpreter state so unwinding an
+	// abandoned generator can't touch the caller's
+	gi := *i
+	gi.generator = context
+	function, args := g.function, g.args
+	go func() {
+		frames := <-context.resume
+		gi.frames = slices.Clone(frames)
+		context.base = len(frames)
+		defer func() {
+			if r := recover(); r != nil {
+				if _, ok := r.(generatorAbandoned); !ok {
+					panic(r)
+				}
+			}
+		}()
+		_, err := function.run(&gi, args, t)
+		context.results <- generatorResult{done: true, err: err}
+	}()
+}
+
+// yield passes a value to the caller of next() and waits to be resumed. It
+// reports false if the generator is closed instead, or already was, and the
+// yield has to return.
+func (c *generatorContext) yield(i *interpreter, value any) bool {
+	if c.closed {
+		return false
+	}
+	own := slices.Clone(i.frames[c.base:])
+	c.results <- generatorResult{value: value}
+	select {
+	case frames := <-c.resume:
+		i.frames = append(slices.Clone(frames), own...)
+		c.base = len(frames)
+		return true
+	case frames := <-c.closing:
+		i.frames = append(slices.Clone(frames), own...)
+		c.base = len(frames)
+		c.closed = true
+		return false
+	case <-c.stop:
+		// the panic isn't a runtime error
+		panic(generatorAbandoned{})
+	}
+}
+
+func generatorNext(i *interpreter, g generator, t token) (any, error) {
+	return g.next(i, t)
+}
+
+func generatorHasNext(i *interpreter, g generator, t token) (any, error) {
+	return g.hasNext(i, t)
+}
+
+type generatorIterator struct {
+	generator   generator
+	interpreter *interpreter
+	token       token
+}
+
+func (it *generatorIterator) hasNext() (bool, error) {
+	return it.generator.hasNext(it.interpreter, it.token)
+}
+func (it *generatorIterator) next() (any, error) {
+	return it.generator.next(it.interpreter, it.token)
+}
+func (it *generatorIterator) close() error {
+	return it.generator.close(it.interpreter, it.token)
+}
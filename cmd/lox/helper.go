@@ -3,7 +3,6 @@ package lox
 import (
 	"fmt"
 	"os"
-	"regexp"
 )
 
 func getFileContent(fileName string) string {
@@ -15,67 +14,43 @@ func getFileContent(fileName string) string {
 	return string(fileContents)
 }
 
-func getPathFromFile(filePath string) string {
-	r := regexp.MustCompile(`[^\/]+$`)
-	dirPath := r.ReplaceAllString(filePath, "")
-	return dirPath
-}
-
-func getFileName(filePath string) string {
-	r := regexp.MustCompile(`[^\/]+$`)
-	dirPath := r.FindString(filePath)
-	return dirPath
-}
-
 func printErrors(errors []loxError) {
 	for _, err := range errors {
 		fmt.Fprintln(os.Stderr, err)
 	}
 }
 
-func handleStmt(stmt stmt, i *interpreter) {
-	defer continueOnError()
-	i.resolveStmt(stmt)
-	i.execute(stmt)
-}
-
-func handleExpr(exp expression, i *interpreter) {
-	defer continueOnError()
-	i.resolveExpr(exp)
-	fmt.Println(i.stringify(i.evaluate(exp)))
-}
-
-func handleExprEval(exp expression, i *interpreter) {
-	defer exitOnError()
-	fmt.Println(i.stringify(i.evaluate(exp)))
-}
-
-func exitOnError() {
-	if r := recover(); r != nil {
-		fmt.Fprintln(os.Stderr, r)
-		os.Exit(70)
+// handleStmt resolves and executes a statement entered in the REPL.
+func handleStmt(s stmt, i *interpreter) error {
+	if err := i.resolveAll([]stmt{s}); err != nil {
+		return err
 	}
+	if s, ok := s.(*stmtExpr); ok {
+		str, err := i.interpretExpr(s.initializer)
+		if err == nil {
+			fmt.Println(str)
+		}
+		return err
+	}
+	return i.interpret([]stmt{s})
 }
 
-func continueOnError() {
-	if r := recover(); r != nil {
-		switch r := r.(type) {
-		case loxError:
-			fmt.Fprintln(os.Stderr, replError(r.String()))
-		default:
-			fmt.Fprintln(os.Stderr, r)
-		}
+// exitOnError reports a runtime error and exits with status 70.
+func exitOnError(err error) {
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(70)
 	}
 }
 
-func recoverLoxError(t token) {
+// recoverError is deferred to turn the panic of a Lox error into a value for
+// *err. Other panics are passed on.
+func recoverError(err *error) {
 	if r := recover(); r != nil {
-		switch r := r.(type) {
-		case loxError:
-			err := newError(r.message, t.line)
-			panic(err)
-		default:
+		loxErr, ok := r.(loxError)
+		if !ok {
 			panic(r)
 		}
+		*err = loxErr
 	}
 }
@@ -2,273 +2,915 @@ package lox
 
 import (
 	"fmt"
+	"math"
 	"reflect"
+	"strings"
 )
 
 type interpreter struct {
 	*resolver
-	*parser
 	*environment
-	locals map[expression]int
-	index  string
+	builtins   *globalTable
+	errorClass *loxClass
+	frames     []callFrame
+	locals     map[expression]slot
+	module     *loxModule
+	modules    map[string]*loxModule
+	generator  *generatorContext
+	// vm runs the bytecode when the interpreter is used by the VM engine.
+	vm *vm
 }
 
-func newInterpreter(str string, index string) *interpreter {
-	glob := newEnvironment(nil)
-	glob.values = globals()
-	locals := make(map[expression]int)
-	p := newParser(str)
-	i := interpreter{nil, p, glob, locals, index}
+// newInterpreter creates an interpreter for the script at filePath, which is
+// empty in the REPL.
+func newInterpreter(filePath string) *interpreter {
+	builtins := &globalTable{nil, globals()}
+	locals := make(map[expression]slot)
+	main := newModule(filePath, builtins, nil)
+	modules := make(map[string]*loxModule)
+	if path, err := canonicalPath(filePath); filePath != "" && err == nil {
+		main.path = path
+		modules[path] = main
+	}
+	i := interpreter{nil, newGlobalEnvironment(builtins), builtins, nil, nil, locals, main, modules, nil, nil}
 	i.resolver = newResolver(&i)
+	i.defineErrorClass()
+	i.environment = newGlobalEnvironment(main.globals)
 	return &i
 }
 
-func (i *interpreter) evaluate(e expression) any {
+func (i *interpreter) evaluate(e expression) (any, error) {
 	return e.accept(i)
 }
 
-func (i *interpreter) execute(s stmt) {
-	defer i.syncOnError()
-	s.accept(i)
+func (i *interpreter) execute(s stmt) completion {
+	return s.accept(i)
 }
 
-func (i *interpreter) interpret(stmts []stmt) {
+// executeStmts executes statements until one of them completes abruptly.
+func (i *interpreter) executeStmts(stmts []stmt) completion {
 	for _, s := range stmts {
-		i.execute(s)
+		if c := s.accept(i); c.kind != normalCompletion {
+			return c
+		}
+	}
+	return completion{}
+}
+
+// interpret executes top-level code and returns the runtime error that
+// ended it.
+func (i *interpreter) interpret(stmts []stmt) error {
+	if c := i.executeStmts(stmts); c.kind == throwCompletion {
+		return c.err
 	}
+	return nil
 }
 
-func (i *interpreter) resolve(expr expression, depth int) {
-	i.locals[expr] = depth
+// interpretExpr evaluates a top-level expression to its string value and
+// returns the runtime error raised instead.
+func (i *interpreter) interpretExpr(e expression) (string, error) {
+	value, err := i.evaluate(e)
+	if err != nil {
+		return "", err
+	}
+	return i.stringify(value)
 }
 
-func (i *interpreter) visitClassStmt(stmt *stmtClass) {
-	i.environment.define(stmt.name.lexeme, nil)
+// slot is where the resolver found a local variable: the number of scopes
+// between its use and its declaration, and its index in that scope.
+type slot struct {
+	depth int
+	index int
+}
+
+func (i *interpreter) resolve(expr expression, depth int, index int) {
+	i.locals[expr] = slot{depth, index}
+}
+
+func (i *interpreter) visitClassStmt(stmt *stmtClass) completion {
+	var superclass *loxClass
+	if stmt.superclass != nil {
+		value, err := i.evaluate(stmt.superclass)
+		if err != nil {
+			return throw(err)
+		}
+		class, ok := value.(*loxClass)
+		if !ok {
+			err := newError("Superclass must be a class.", stmt.superclass.token().line)
+			return throw(err)
+		}
+		superclass = class
+	}
+	env := i.environment
+	if superclass != nil {
+		env = newEnvironment(env, 1)
+		env.define("super", superclass)
+	}
 	methods := make(map[string]*loxFunction)
 	for _, m := range stmt.methods {
-		fun := &loxFunction{newEnvironment(i.environment), m}
+		fun := &loxFunction{env, m, m.name.lexeme == "init"}
 		methods[m.name.lexeme] = fun
 	}
-	class := &loxClass{methods, stmt.name.lexeme}
-	i.assign(stmt.name, class)
+	staticMethods := make(map[string]*loxFunction)
+	for _, m := range stmt.staticMethods {
+		staticMethods[m.name.lexeme] = &loxFunction{env, m, false}
+	}
+	class := &loxClass{superclass, methods, staticMethods, make(map[string]any), stmt.name.lexeme}
+	i.environment.define(stmt.name.lexeme, class)
+	for _, field := range stmt.staticFields {
+		var val any
+		if field.initializer != nil {
+			var err error
+			if val, err = i.evaluate(field.initializer); err != nil {
+				return throw(err)
+			}
+		}
+		class.fields[field.name.lexeme] = val
+	}
+	return completion{}
 }
 
-func (i *interpreter) visitFunStmt(s *stmtFun) {
-	function := &loxFunction{newEnvironment(i.environment), s}
+func (i *interpreter) visitFunStmt(s *stmtFun) completion {
+	function := &loxFunction{i.environment, s, false}
 	i.environment.define(s.name.lexeme, function)
+	return completion{}
 }
 
-func (i *interpreter) visitVarStmt(s *stmtVar) {
+func (i *interpreter) visitVarStmt(s *stmtVar) completion {
 	var val any
 	name := s.name.lexeme
 	if s.initializer != nil {
-		val = i.evaluate(s.initializer)
+		var err error
+		if val, err = i.evaluate(s.initializer); err != nil {
+			return throw(err)
+		}
 	}
 	i.environment.define(name, val)
+	return completion{}
 }
 
-func (i *interpreter) visitIfStmt(s *stmtIf) {
-	if i.isTruthy(s.condition) {
-		i.execute(s.thenBranch)
+func (i *interpreter) visitIfStmt(s *stmtIf) completion {
+	condition, err := i.isTruthy(s.condition)
+	if err != nil {
+		return throw(err)
+	}
+	if condition {
+		return i.execute(s.thenBranch)
 	} else if s.elseBranch != nil {
-		i.execute(s.elseBranch)
+		return i.execute(s.elseBranch)
 	}
+	return completion{}
 }
 
-type returnValue struct {
-	value any
+func (i *interpreter) visitReturnStmt(s *stmtReturn) completion {
+	if s.value == nil {
+		return completion{kind: returnCompletion}
+	}
+	value, err := i.evaluate(s.value)
+	if err != nil {
+		return throw(err)
+	}
+	return completion{kind: returnCompletion, value: value}
 }
 
-func (i *interpreter) visitReturnStmt(s *stmtReturn) {
-	if s.value == nil {
-		// TODO: handle return globally and in REPL expressions
-		panic(returnValue{nil})
+func (i *interpreter) visitWhileStmt(s *stmtWhile) completion {
+	for {
+		condition, err := i.isTruthy(s.condition)
+		if err != nil {
+			return throw(err)
+		}
+		if !condition {
+			return completion{}
+		}
+		switch c := i.execute(s.body); c.kind {
+		case breakCompletion:
+			return completion{}
+		case returnCompletion, throwCompletion:
+			return c
+		}
+		if s.increment != nil {
+			if _, err := i.evaluate(s.increment); err != nil {
+				return throw(err)
+			}
+		}
 	}
-	panic(returnValue{i.evaluate(s.value)})
 }
 
-func (i *interpreter) visitWhileStmt(s *stmtWhile) {
-	for i.isTruthy(s.condition) {
-		i.execute(s.body)
+func (i *interpreter) visitForInStmt(s *stmtForIn) completion {
+	iterable, err := i.evaluate(s.iterable)
+	if err != nil {
+		return throw(err)
+	}
+	it, err := i.iterate(iterable, s.token)
+	if err != nil {
+		return throw(err)
+	}
+	for {
+		hasNext, err := it.hasNext()
+		if err != nil {
+			return throw(err)
+		}
+		if !hasNext {
+			return completion{}
+		}
+		value, err := it.next()
+		if err != nil {
+			return throw(err)
+		}
+		env := newEnvironment(i.environment, 1)
+		env.define(s.name.lexeme, value)
+		switch c := i.executeBlock([]stmt{s.body}, env); c.kind {
+		case breakCompletion:
+			return closeIterator(it, completion{})
+		case returnCompletion, throwCompletion:
+			return closeIterator(it, c)
+		}
+	}
+}
+
+// closeIterator closes the iterator of a for-in loop left early with the
+// completion c, which an error raised by closing it replaces.
+func closeIterator(it iterator, c completion) completion {
+	if it, ok := it.(closer); ok {
+		if err := it.close(); err != nil {
+			return throw(err)
+		}
+	}
+	return c
+}
+
+// visitTryStmt runs the catch block for a throw or runtime error in the try
+// block. The finally block runs after both however they complete, and takes
+// precedence if it completes abruptly itself.
+func (i *interpreter) visitTryStmt(s *stmtTry) completion {
+	c := i.execute(s.body)
+	if c.kind == throwCompletion && s.catchBody != nil {
+		value := c.err.value
+		if !c.err.hasValue() {
+			value = i.errorObject(c.err.message, c.err.line)
+		}
+		env := newEnvironment(i.environment, s.catchBody.(*stmtBlock).size)
+		env.define(s.catchName.lexeme, value)
+		c = i.executeBlock(s.catchBody.(*stmtBlock).statements, env)
+	}
+	if s.finallyBody != nil {
+		if f := i.execute(s.finallyBody); f.kind != normalCompletion {
+			return f
+		}
+	}
+	return c
+}
+
+func (i *interpreter) visitThrowStmt(s *stmtThrow) completion {
+	value, err := i.evaluate(s.value)
+	if err != nil {
+		return throw(err)
+	}
+	message, err := i.stringify(value)
+	if err != nil {
+		return throw(err)
+	}
+	if instance, ok := i.isErrorObject(value); ok {
+		if message, err = i.stringify(instance.fields["message"]); err != nil {
+			return throw(err)
+		}
+		instance.fields["line"] = float64(s.line)
+		instance.fields["stack"] = i.stackTrace(s.line)
+	}
+	thrown := newError(message, s.line)
+	thrown.value, thrown.thrown = value, true
+	return completion{kind: throwCompletion, err: thrown}
+}
+
+func (i *interpreter) visitYieldStmt(s *stmtYield) completion {
+	var value any
+	if s.value != nil {
+		var err error
+		if value, err = i.evaluate(s.value); err != nil {
+			return throw(err)
+		}
+	}
+	if !i.generator.yield(i, value) {
+		return completion{kind: returnCompletion}
+	}
+	return completion{}
+}
+
+func (i *interpreter) visitBreakStmt(s *stmtBreak) completion {
+	return completion{kind: breakCompletion}
+}
+
+func (i *interpreter) visitContinueStmt(s *stmtContinue) completion {
+	return completion{kind: continueCompletion}
+}
+
+func (i *interpreter) visitImportStmt(s *stmtImport) completion {
+	m, err := i.importModule(s.path.literal, s.token, i.runModule)
+	if err != nil {
+		return throw(err)
+	}
+	if s.alias.lexeme != "" {
+		i.environment.define(s.alias.lexeme, m)
 	}
+	for _, name := range s.names {
+		value, err := m.get(name)
+		if err != nil {
+			return throw(err)
+		}
+		i.environment.define(name.lexeme, value)
+	}
+	return completion{}
+}
+
+func (i *interpreter) visitExportStmt(s *stmtExport) completion {
+	c := i.execute(s.declaration)
+	i.module.exports[s.name().lexeme] = true
+	return c
 }
 
-func (i *interpreter) visitBlockStmt(s *stmtBlock) {
-	i.executeBlock(s.statements, newEnvironment(i.environment))
+func (i *interpreter) visitBlockStmt(s *stmtBlock) completion {
+	return i.executeBlock(s.statements, newEnvironment(i.environment, s.size))
 }
 
-func (i *interpreter) executeBlock(stmts []stmt, env *environment) {
+// executeBlock executes statements in env and restores the current
+// environment however they complete.
+func (i *interpreter) executeBlock(stmts []stmt, env *environment) completion {
 	prevEnv := i.environment
-	defer func() { i.environment = prevEnv }()
 	i.environment = env
-	i.interpret(stmts)
+	c := i.executeStmts(stmts)
+	i.environment = prevEnv
+	return c
 }
 
-func (i *interpreter) visitExprStmt(s *stmtExpr) {
-	i.evaluate(s.initializer)
+func (i *interpreter) visitExprStmt(s *stmtExpr) completion {
+	if _, err := i.evaluate(s.initializer); err != nil {
+		return throw(err)
+	}
+	return completion{}
 }
 
-func (i *interpreter) visitVar(e *expressionVar) any {
+func (i *interpreter) visitVar(e *expressionVar) (any, error) {
 	return i.lookupVariable(e)
 }
 
-func (i *interpreter) lookupVariable(e expression) any {
-	distance, ok := i.locals[e]
-	if ok {
-		return i.getAt(distance, e.token())
+func (i *interpreter) lookupVariable(e expression) (any, error) {
+	if slot, ok := i.locals[e]; ok {
+		return i.getAt(slot.depth, slot.index), nil
 	}
-	return i.get(e.token())
+	return i.globals.get(e.token())
 }
 
-func (i *interpreter) visitAssignment(e *expressionAssignment) any {
-	value := i.evaluate(e.next())
-	distance, ok := i.locals[e]
-	if ok {
-		i.assignAt(distance, e.expr().token(), value)
-	} else {
-		i.assign(e.expr().token(), value)
+// assignVariable assigns to the variable named by t, which the resolver
+// resolved for the expression e.
+func (i *interpreter) assignVariable(e expression, t token, value any) error {
+	if slot, ok := i.locals[e]; ok {
+		i.assignAt(slot.depth, slot.index, value)
+		return nil
+	}
+	return i.globals.assign(t, value)
+}
+
+func (i *interpreter) visitAssignment(e *expressionAssignment) (any, error) {
+	value, err := i.evaluate(e.next())
+	if err != nil {
+		return nil, err
+	}
+	if err := i.assignVariable(e, e.expr().token(), value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func (i *interpreter) visitIndexSet(e *expressionIndexSet) (any, error) {
+	object, err := i.indexable(e.expression, e.bracket)
+	if err != nil {
+		return nil, err
+	}
+	index, err := i.evaluate(e.index)
+	if err != nil {
+		return nil, err
+	}
+	val, err := i.evaluate(e.value)
+	if err != nil {
+		return nil, err
 	}
-	return value
+	if err := object.setAt(index, val, e.bracket); err != nil {
+		return nil, err
+	}
+	return val, nil
 }
 
-func (i *interpreter) visitSet(expr *expressionSet) any {
-	object := i.evaluate(expr.expression)
-	instance, ok := object.(*loxInstance)
+func (i *interpreter) visitCompound(e *expressionCompound) (any, error) {
+	switch target := e.expression.(type) {
+	case *expressionVar:
+		old, err := i.lookupVariable(target)
+		if err != nil {
+			return nil, err
+		}
+		val, err := i.compoundValue(e, old)
+		if err != nil {
+			return nil, err
+		}
+		if err := i.assignVariable(target, target.token(), val); err != nil {
+			return nil, err
+		}
+		return e.result(old, val), nil
+	case *expressionGet:
+		object, err := i.object(target.expression)
+		if err != nil {
+			return nil, err
+		}
+		old, err := object.get(i, target.name)
+		if err != nil {
+			return nil, err
+		}
+		val, err := i.compoundValue(e, old)
+		if err != nil {
+			return nil, err
+		}
+		object.set(target.name, val)
+		return e.result(old, val), nil
+	case *expressionIndex:
+		object, err := i.indexable(target.expression, target.bracket)
+		if err != nil {
+			return nil, err
+		}
+		index, err := i.evaluate(target.index)
+		if err != nil {
+			return nil, err
+		}
+		old, err := object.at(index, target.bracket)
+		if err != nil {
+			return nil, err
+		}
+		val, err := i.compoundValue(e, old)
+		if err != nil {
+			return nil, err
+		}
+		if err := object.setAt(index, val, target.bracket); err != nil {
+			return nil, err
+		}
+		return e.result(old, val), nil
+	}
+	return nil, nil
+}
+
+// compoundValue applies the arithmetic operator of a compound assignment or
+// increment to the already evaluated value of its target.
+func (i *interpreter) compoundValue(e *expressionCompound, old any) (any, error) {
+	var value any = 1.0
+	if e.value != nil {
+		var err error
+		if value, err = i.evaluate(e.value); err != nil {
+			return nil, err
+		}
+	}
+	return i.arithmetic(e.operation, old, value)
+}
+
+func (i *interpreter) visitSet(expr *expressionSet) (any, error) {
+	object, err := i.object(expr.expression)
+	if err != nil {
+		return nil, err
+	}
+	val, err := i.evaluate(expr.value)
+	if err != nil {
+		return nil, err
+	}
+	object.set(expr.name, val)
+	return val, nil
+}
+
+// object evaluates the object of a field assignment.
+func (i *interpreter) object(e expression) (loxObject, error) {
+	value, err := i.evaluate(e)
+	if err != nil {
+		return nil, err
+	}
+	object, ok := value.(loxObject)
 	if !ok {
-		err := newError("Only instances have fields.", expr.token().line)
-		panic(err)
+		return nil, newError("Only instances have fields.", e.token().line)
 	}
-	val := i.evaluate(expr.value)
-	instance.set(expr.name, val)
-	return val
+	return object, nil
 }
 
-func (i *interpreter) visitLogical(e *expressionLogical) any {
-	if e.tokenType() == OR {
-		if i.isTruthy(e.expr()) {
-			return i.evaluate(e.expr())
+func (i *interpreter) visitLogical(e *expressionLogical) (any, error) {
+	left, err := i.evaluate(e.expr())
+	if err != nil {
+		return nil, err
+	}
+	switch e.tokenType() {
+	case QUESTION_QUESTION:
+		if left != nil {
+			return left, nil
+		}
+	case OR:
+		if isTruthy(left) {
+			return left, nil
+		}
+	default:
+		if !isTruthy(left) {
+			return left, nil
 		}
-	} else if !i.isTruthy(e.expr()) {
-		return i.evaluate(e.expr())
 	}
 	return i.evaluate(e.next())
 }
 
-func (i *interpreter) visitEquality(e *expressionEquality) any {
-	left := i.evaluate(e.expr())
-	right := i.evaluate(e.next())
-	if !i.hasSameType(left, right) {
-		return false
+// operands evaluates the operands of a binary expression.
+func (i *interpreter) operands(e expression) (any, any, error) {
+	left, err := i.evaluate(e.expr())
+	if err != nil {
+		return nil, nil, err
 	}
-	switch e.tokenType() {
-	case EQUAL_EQUAL:
-		return left == right
-	case BANG_EQUAL:
-		return left != right
+	right, err := i.evaluate(e.next())
+	return left, right, err
+}
+
+func (i *interpreter) visitEquality(e *expressionEquality) (any, error) {
+	left, right, err := i.operands(e)
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	equal, err := i.isEqual(left, right, e.token())
+	if err != nil {
+		return nil, err
+	}
+	if e.tokenType() == BANG_EQUAL {
+		return !equal, nil
+	}
+	return equal, nil
 }
 
-func (i *interpreter) visitComparison(e *expressionComparison) any {
-	left := i.parseFloat(e.expr())
-	right := i.parseFloat(e.next())
+func (i *interpreter) visitComparison(e *expressionComparison) (any, error) {
+	leftVal, rightVal, err := i.operands(e)
+	if err != nil {
+		return nil, err
+	}
+	if result, ok, err := i.compare(leftVal, e.token(), rightVal); ok || err != nil {
+		return result, err
+	}
+	left, right, err := i.numbers(leftVal, rightVal, e)
+	if err != nil {
+		return nil, err
+	}
 	switch e.tokenType() {
 	case LESS:
-		return left < right
+		return left < right, nil
 	case LESS_EQUAL:
-		return left <= right
+		return left <= right, nil
 	case GREATER:
-		return left > right
+		return left > right, nil
 	case GREATER_EQUAL:
-		return left >= right
+		return left >= right, nil
 	}
-	return nil
+	return nil, nil
 }
 
-func (i *interpreter) visitTerm(e *expressionTerm) any {
+func (i *interpreter) visitTerm(e *expressionTerm) (any, error) {
+	left, right, err := i.operands(e)
+	if err != nil {
+		return nil, err
+	}
+	return i.arithmetic(e, left, right)
+}
+
+func (i *interpreter) visitFactor(e *expressionFactor) (any, error) {
+	left, right, err := i.operands(e)
+	if err != nil {
+		return nil, err
+	}
+	return i.arithmetic(e, left, right)
+}
+
+// arithmetic applies the operator of the term or factor e to the values of
+// its operands, which compound assignments pass without evaluating e.
+func (i *interpreter) arithmetic(e expression, leftVal any, rightVal any) (any, error) {
+	if result, ok, err := i.overload(leftVal, e.token(), rightVal); ok || err != nil {
+		return result, err
+	}
+	if e.tokenType() == PLUS {
+		if ok, left, right := i.areStrings(leftVal, rightVal); ok {
+			return fmt.Sprintf("%v%v", left, right), nil
+		}
+	}
+	left, right, err := i.numbers(leftVal, rightVal, e)
+	if err != nil {
+		return nil, err
+	}
 	switch e.tokenType() {
 	case PLUS:
-		if ok, left, right := i.evaluatesToString(e); ok {
-			return fmt.Sprintf("%v%v", left, right)
-		}
-		left := i.parseFloat(e.expr())
-		right := i.parseFloat(e.next())
-		return left + right
+		return left + right, nil
 	case MINUS:
-		left := i.parseFloat(e.expr())
-		right := i.parseFloat(e.next())
-		return left - right
+		return left - right, nil
+	case STAR:
+		return left * right, nil
+	case SLASH:
+		return left / right, nil
+	case PERCENT:
+		return math.Mod(left, right), nil
+	}
+	return math.Trunc(left / right), nil
+}
+
+func (i *interpreter) visitPower(e *expressionPower) (any, error) {
+	left, err := i.parseFloat(e.expr())
+	if err != nil {
+		return nil, err
+	}
+	right, err := i.parseFloat(e.next())
+	if err != nil {
+		return nil, err
 	}
-	return 0
+	return math.Pow(left, right), nil
 }
 
-func (i *interpreter) visitFactor(e *expressionFactor) any {
-	left := i.parseFloat(e.expr())
-	right := i.parseFloat(e.next())
+func (i *interpreter) visitBitwise(e *expressionBitwise) (any, error) {
+	left, err := i.parseInt(e.expr())
+	if err != nil {
+		return nil, err
+	}
+	right, err := i.parseInt(e.next())
+	if err != nil {
+		return nil, err
+	}
 	switch e.tokenType() {
-	case STAR:
-		return left * right
-	case SLASH:
-		return left / right
+	case AMPERSAND:
+		return float64(left & right), nil
+	case PIPE:
+		return float64(left | right), nil
+	case CARET:
+		return float64(left ^ right), nil
+	case LESS_LESS, GREATER_GREATER:
+		if right < 0 {
+			return nil, newError(fmt.Sprintf("Shift count can't be negative: %v", right), e.token().line)
+		}
+		if e.tokenType() == LESS_LESS {
+			return float64(left << right), nil
+		}
+		return float64(left >> right), nil
 	}
-	return ""
+	return nil, nil
 }
 
-func (i *interpreter) visitUnary(e *expressionUnary) any {
+func (i *interpreter) visitUnary(e *expressionUnary) (any, error) {
 	switch e.tokenType() {
 	case BANG:
-		return !i.isTruthy(e.next())
+		truthy, err := i.isTruthy(e.next())
+		return !truthy, err
 	case MINUS:
-		val := i.parseFloat(e.next())
-		return -val
+		val, err := i.parseFloat(e.next())
+		return -val, err
+	case TILDE:
+		val, err := i.parseInt(e.next())
+		return float64(^val), err
 	default:
-		return false
+		return false, nil
 	}
 }
 
-func (i *interpreter) visitGet(expr *expressionGet) any {
-	object := i.evaluate(expr.expression)
-	instance, ok := object.(*loxInstance)
+func (i *interpreter) visitGet(expr *expressionGet) (any, error) {
+	object, err := i.evaluate(expr.expression)
+	if err != nil {
+		return nil, err
+	}
+	if i.shortCircuits(object, expr.optional) {
+		return shortCircuit{}, nil
+	}
+	switch object := object.(type) {
+	case *loxInstance:
+		return object.get(i, expr.name)
+	case *loxClass:
+		return object.get(i, expr.name)
+	case *loxList:
+		return object.get(expr.name)
+	case *loxMap:
+		return object.get(expr.name)
+	case *loxModule:
+		return object.get(expr.name)
+	case *loxGenerator:
+		return object.get(expr.name)
+	}
+	return nil, newError("Only instances have properties.", expr.token().line)
+}
+
+type indexable interface {
+	at(index any, t token) (any, error)
+	setAt(index any, value any, t token) error
+}
+
+func (i *interpreter) visitIndex(e *expressionIndex) (any, error) {
+	value, err := i.evaluate(e.expression)
+	if err != nil {
+		return nil, err
+	}
+	if i.shortCircuits(value, e.optional) {
+		return shortCircuit{}, nil
+	}
+	object, err := i.toIndexable(value, e.bracket)
+	if err != nil {
+		return nil, err
+	}
+	index, err := i.evaluate(e.index)
+	if err != nil {
+		return nil, err
+	}
+	return object.at(index, e.bracket)
+}
+
+func (i *interpreter) indexable(e expression, bracket token) (indexable, error) {
+	value, err := i.evaluate(e)
+	if err != nil {
+		return nil, err
+	}
+	return i.toIndexable(value, bracket)
+}
+
+func (i *interpreter) toIndexable(value any, bracket token) (indexable, error) {
+	if index := specialMethod(value, "__index__"); index != nil {
+		return &instanceIndex{i, index}, nil
+	}
+	object, ok := value.(indexable)
 	if !ok {
-		err := newError("Only instances have properties.", expr.token().line)
-		panic(err)
+		return nil, newError("Only lists and maps can be indexed.", bracket.line)
 	}
-	return instance.get(expr.name)
+	return object, nil
 }
 
-func (i *interpreter) visitCall(e *expressionCall) any {
-	defer recoverLoxError(e.token())
-	callee := i.evaluate(e.expression)
-	args := make([]any, 0)
-	for _, arg := range e.args {
-		args = append(args, i.evaluate(arg))
+// visitCall reports the errors raised in the call at its line, so that
+// they take the line of the outermost call they are in.
+func (i *interpreter) visitCall(e *expressionCall) (any, error) {
+	value, err := i.callExpr(e)
+	if err != nil {
+		return nil, atLine(err, e.token().line)
+	}
+	return value, nil
+}
+
+func (i *interpreter) callExpr(e *expressionCall) (any, error) {
+	callee, err := i.evaluate(e.expression)
+	if err != nil {
+		return nil, err
+	}
+	if i.shortCircuits(callee, e.optional) {
+		return shortCircuit{}, nil
+	}
+	args, err := i.evaluateArgs(e.args)
+	if err != nil {
+		return nil, err
+	}
+	if call := specialMethod(callee, "__call__"); call != nil {
+		callee = call
 	}
 	function, ok := callee.(callable)
 	if !ok {
-		panic(newError("Can only call functions and classes.", e.token().line))
+		return nil, newError("Can only call functions and classes.", e.token().line)
 	}
-	if len(e.args) != function.arity() {
-		err := newError(fmt.Sprintf("Expected %d arguments but got %d.", function.arity(), len(e.args)), e.token().line)
-		panic(err)
+	if err := checkArity(function, len(args), e.token()); err != nil {
+		return nil, err
 	}
 	return function.call(i, args, e.token())
 }
 
-func (i *interpreter) visitLiteral(e *expressionLiteral) any {
-	return e.value()
+// evaluateArgs evaluates the arguments of a call or the elements of a list,
+// expanding spread iterables in place.
+func (i *interpreter) evaluateArgs(exprs []expression) ([]any, error) {
+	values := make([]any, 0, len(exprs))
+	for _, expr := range exprs {
+		spread, ok := expr.(*expressionSpread)
+		if !ok {
+			value, err := i.evaluate(expr)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+			continue
+		}
+		iterable, err := i.evaluate(spread.expr())
+		if err != nil {
+			return nil, err
+		}
+		it, err := i.iterate(iterable, spread.token())
+		if err != nil {
+			return nil, err
+		}
+		if values, err = appendAll(values, it); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+func (i *interpreter) visitSpread(e *expressionSpread) (any, error) {
+	return nil, newError("Can only spread in argument lists and lists.", e.token().line)
 }
 
-func (i *interpreter) visitGroup(e *expressionGroup) any {
+func (i *interpreter) visitList(e *expressionList) (any, error) {
+	elements, err := i.evaluateArgs(e.elements)
+	if err != nil {
+		return nil, err
+	}
+	return newList(elements), nil
+}
+
+func (i *interpreter) visitMap(e *expressionMap) (any, error) {
+	m := newMap()
+	for index, key := range e.keys {
+		k, err := i.evaluate(key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := i.evaluate(e.values[index])
+		if err != nil {
+			return nil, err
+		}
+		if err := m.setAt(k, v, e.token()); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func (i *interpreter) visitInterpolation(e *expressionInterpolation) (any, error) {
+	var b strings.Builder
+	for _, part := range e.parts {
+		value, err := i.evaluate(part)
+		if err != nil {
+			return nil, err
+		}
+		str, err := i.stringify(value)
+		if err != nil {
+			return nil, err
+		}
+		b.WriteString(str)
+	}
+	return b.String(), nil
+}
+
+func (i *interpreter) visitLambda(e *expressionLambda) (any, error) {
+	return &loxFunction{i.environment, e.function, false}, nil
+}
+
+func (i *interpreter) visitSuper(e *expressionSuper) (any, error) {
+	distance := i.locals[e].depth
+	superclass := i.getAt(distance, 0).(*loxClass)
+	this := i.getAt(distance-1, 0)
+	var method *loxFunction
+	if _, ok := this.(*loxClass); ok {
+		method = superclass.findStatic(e.method.lexeme)
+	} else {
+		method = superclass.findMethod(e.method.lexeme)
+	}
+	if method == nil {
+		return nil, newError(fmt.Sprintf("Undefined property '%s'.", e.method.lexeme), e.method.line)
+	}
+	return method.bind(this).property(i, e.method)
+}
+
+func (i *interpreter) visitThis(e *expressionThis) (any, error) {
+	return i.lookupVariable(e)
+}
+
+// shortCircuit is the value of the links of an optional chain after a '?.'
+// found nil. The expressionOptional around the chain turns it into nil.
+type shortCircuit struct{}
+
+func (i *interpreter) shortCircuits(object any, optional bool) bool {
+	_, ok := object.(shortCircuit)
+	return ok || optional && object == nil
+}
+
+func (i *interpreter) visitOptional(e *expressionOptional) (any, error) {
+	value, err := i.evaluate(e.expression)
+	if _, ok := value.(shortCircuit); ok {
+		return nil, nil
+	}
+	return value, err
+}
+
+func (i *interpreter) visitTernary(e *expressionTernary) (any, error) {
+	condition, err := i.isTruthy(e.expr())
+	if err != nil {
+		return nil, err
+	}
+	if condition {
+		return i.evaluate(e.next())
+	}
+	return i.evaluate(e.elseBranch)
+}
+
+func (i *interpreter) visitLiteral(e *expressionLiteral) (any, error) {
+	return e.value(), nil
+}
+
+func (i *interpreter) visitGroup(e *expressionGroup) (any, error) {
 	return i.evaluate(e.expression)
 }
 
-func (i *interpreter) visitExpr(e *exp) any {
-	return ""
+func (i *interpreter) visitExpr(e *exp) (any, error) {
+	return "", nil
 }
 
-func (i *interpreter) evaluatesToString(e expression) (bool, any, any) {
-	left := i.evaluate(e.expr())
-	right := i.evaluate(e.next())
+func (i *interpreter) areStrings(left any, right any) (bool, any, any) {
 	if left == nil {
 		left = "nil"
 	}
@@ -279,14 +921,51 @@ func (i *interpreter) evaluatesToString(e expression) (bool, any, any) {
 		reflect.TypeOf(right).Name() == "string", left, right
 }
 
-func (i *interpreter) parseFloat(e expression) float64 {
-	n := i.evaluate(e)
-	switch n := n.(type) {
-	case float64:
-		return n
+func (i *interpreter) parseFloat(e expression) (float64, error) {
+	value, err := i.evaluate(e)
+	if err != nil {
+		return 0, err
+	}
+	return i.number(value, e)
+}
+
+// number checks that the value of the operand e is a number.
+func (i *interpreter) number(value any, e expression) (float64, error) {
+	if n, ok := value.(float64); ok {
+		return n, nil
 	}
-	err := newError(fmt.Sprintf("Operand must be a number: %v", e.lexeme()), e.token().line)
-	panic(err)
+	return 0, newError(fmt.Sprintf("Operand must be a number: %v", e.lexeme()), e.token().line)
+}
+
+// numbers checks that the values of both operands of the binary expression e
+// are numbers.
+func (i *interpreter) numbers(left any, right any, e expression) (float64, float64, error) {
+	l, err := i.number(left, e.expr())
+	if err != nil {
+		return 0, 0, err
+	}
+	r, err := i.number(right, e.next())
+	return l, r, err
+}
+
+func (i *interpreter) parseInt(e expression) (int64, error) {
+	value, err := i.evaluate(e)
+	if err != nil {
+		return 0, err
+	}
+	return i.integer(value, e)
+}
+
+// integer checks that the value of the operand e is an integer.
+func (i *interpreter) integer(value any, e expression) (int64, error) {
+	n, err := i.number(value, e)
+	if err != nil {
+		return 0, err
+	}
+	if n != math.Trunc(n) || math.Abs(n) > 1<<53 {
+		return 0, newError(fmt.Sprintf("Operand must be an integer: %v", e.lexeme()), e.token().line)
+	}
+	return int64(n), nil
 }
 
 func (i *interpreter) hasSameType(a any, b any) bool {
@@ -296,8 +975,27 @@ func (i *interpreter) hasSameType(a any, b any) bool {
 	return reflect.TypeOf(a).Name() == reflect.TypeOf(b).Name()
 }
 
-func (i *interpreter) isTruthy(e expression) bool {
-	value := i.evaluate(e)
+func (i *interpreter) isEqual(a any, b any, t token) (bool, error) {
+	if eq := specialMethod(a, operatorMethods[EQUAL_EQUAL]); eq != nil {
+		result, err := i.callSpecial(operatorMethods[EQUAL_EQUAL], eq, []any{b}, t)
+		return isTruthy(result), err
+	}
+	if eq := specialMethod(b, operatorMethods[EQUAL_EQUAL]); eq != nil {
+		result, err := i.callSpecial(operatorMethods[EQUAL_EQUAL], eq, []any{a}, t)
+		return isTruthy(result), err
+	}
+	if !i.hasSameType(a, b) {
+		return false, nil
+	}
+	return a == b, nil
+}
+
+func (i *interpreter) isTruthy(e expression) (bool, error) {
+	value, err := i.evaluate(e)
+	return isTruthy(value), err
+}
+
+func isTruthy(value any) bool {
 	switch value := value.(type) {
 	case string:
 		return value != ""
@@ -312,16 +1010,41 @@ func (i *interpreter) isTruthy(e expression) bool {
 	}
 }
 
-func (i *interpreter) stringify(val any) string {
-	if val == nil {
-		return "nil"
+func (i *interpreter) stringify(val any) (string, error) {
+	if str := specialMethod(val, "__str__"); str != nil {
+		result, err := i.callSpecial("__str__", str, nil, token{})
+		if err != nil {
+			return "", err
+		}
+		return i.stringify(result)
 	}
-	return fmt.Sprintf("%v", val)
-}
-
-func (i *interpreter) syncOnError() {
-	if r := recover(); r != nil {
-		i.synchronize()
-		panic(r)
+	switch val := val.(type) {
+	case nil:
+		return "nil", nil
+	case *loxList:
+		s := make([]string, len(val.elements))
+		for index, element := range val.elements {
+			str, err := i.stringify(element)
+			if err != nil {
+				return "", err
+			}
+			s[index] = str
+		}
+		return "[" + strings.Join(s, ", ") + "]", nil
+	case *loxMap:
+		s := make([]string, len(val.keys))
+		for index, key := range val.keys {
+			k, err := i.stringify(key)
+			if err != nil {
+				return "", err
+			}
+			v, err := i.stringify(val.values[key])
+			if err != nil {
+				return "", err
+			}
+			s[index] = k + ": " + v
+		}
+		return "{" + strings.Join(s, ", ") + "}", nil
 	}
+	return fmt.Sprintf("%v", val), nil
 }
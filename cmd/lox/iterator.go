@@ -0,0 +1,168 @@
+package lox
+
+import "fmt"
+
+// iterator steps through the values of a for-in loop.
+type iterator interface {
+	hasNext() (bool, error)
+	next() (any, error)
+}
+
+// closer is an iterator that for-in loops close when they are left early,
+// by break, return or an error.
+type closer interface {
+	close() error
+}
+
+type listIterator struct {
+	list  *loxList
+	index int
+}
+
+type mapIterator struct {
+	keys  []any
+	index int
+}
+
+type stringIterator struct {
+	chars []rune
+	index int
+}
+
+// instanceIterator calls the hasNext and next methods of a Lox object.
+type instanceIterator struct {
+	interpreter *interpreter
+	hasNextFn   callable
+	nextFn      callable
+	token       token
+}
+
+type loxRange struct {
+	start float64
+	end   float64
+	step  float64
+}
+
+type rangeIterator struct {
+	r     *loxRange
+	index int
+}
+
+// iterate returns an iterator over the value of a for-in loop. Lists are
+// iterated by element, maps by key and strings by character. Objects either
+// have an iter method returning an iterable value, like an object with
+// hasNext and next methods, or have these methods themselves.
+func (i *interpreter) iterate(value any, t token) (iterator, error) {
+	switch value := value.(type) {
+	case *loxList:
+		return &listIterator{value, 0}, nil
+	case *loxMap:
+		keys := make([]any, len(value.keys))
+		copy(keys, value.keys)
+		return &mapIterator{keys, 0}, nil
+	case string:
+		return &stringIterator{[]rune(value), 0}, nil
+	case *loxRange:
+		return &rangeIterator{value, 0}, nil
+	case *loxGenerator:
+		return &generatorIterator{value, i, t}, nil
+	case *vmGenerator:
+		return &generatorIterator{value, i, t}, nil
+	case *loxInstance, *vmInstance:
+		if iter := specialMethod(value, "iter"); iter != nil {
+			result, err := iter.call(i, nil, t)
+			if err != nil {
+				return nil, err
+			}
+			if !isInstance(result) {
+				return i.iterate(result, t)
+			}
+			value = result
+		}
+		hasNext, next := specialMethod(value, "hasNext"), specialMethod(value, "next")
+		if hasNext == nil || next == nil || !acceptsArgs(hasNext, 0) || !acceptsArgs(next, 0) {
+			return nil, newError("Iterator must have 'hasNext' and 'next' methods without parameters.", t.line)
+		}
+		return &instanceIterator{i, hasNext, next, t}, nil
+	}
+	return nil, newError("Can only iterate over lists, maps, strings, ranges, generators and iterable objects.", t.line)
+}
+
+// appendAll appends the remaining values of the iterator to values.
+func appendAll(values []any, it iterator) ([]any, error) {
+	for {
+		hasNext, err := it.hasNext()
+		if err != nil || !hasNext {
+			return values, err
+		}
+		value, err := it.next()
+		if err != nil {
+			return values, err
+		}
+		values = append(values, value)
+	}
+}
+
+func (it *listIterator) hasNext() (bool, error) { return it.index < len(it.list.elements), nil }
+func (it *listIterator) next() (any, error) {
+	it.index++
+	return it.list.elements[it.index-1], nil
+}
+
+func (it *mapIterator) hasNext() (bool, error) { return it.index < len(it.keys), nil }
+func (it *mapIterator) next() (any, error) {
+	it.index++
+	return it.keys[it.index-1], nil
+}
+
+func (it *stringIterator) hasNext() (bool, error) { return it.index < len(it.chars), nil }
+func (it *stringIterator) next() (any, error) {
+	it.index++
+	return string(it.chars[it.index-1]), nil
+}
+
+func (it *instanceIterator) hasNext() (bool, error) {
+	result, err := it.hasNextFn.call(it.interpreter, nil, it.token)
+	return isTruthy(result), err
+}
+func (it *instanceIterator) next() (any, error) {
+	return it.nextFn.call(it.interpreter, nil, it.token)
+}
+
+// newRange takes the end, the start and end, or the start, end and step.
+func newRange(_ *interpreter, args []any, t token) (any, error) {
+	bounds := []float64{0, 0, 1}
+	for index, arg := range args {
+		n, ok := arg.(float64)
+		if !ok {
+			return nil, newError("range - Arguments must be numbers.", t.line)
+		}
+		bounds[index] = n
+	}
+	if len(args) == 1 {
+		bounds[0], bounds[1] = 0, bounds[0]
+	}
+	if bounds[2] == 0 {
+		return nil, newError("range - Step can't be 0.", t.line)
+	}
+	return &loxRange{bounds[0], bounds[1], bounds[2]}, nil
+}
+
+func (r *loxRange) String() string {
+	return fmt.Sprintf("range(%v, %v, %v)", r.start, r.end, r.step)
+}
+
+func (it *rangeIterator) hasNext() (bool, error) {
+	if it.r.step > 0 {
+		return it.value() < it.r.end, nil
+	}
+	return it.value() > it.r.end, nil
+}
+func (it *rangeIterator) next() (any, error) {
+	it.index++
+	return it.r.start + float64(it.index-1)*it.r.step, nil
+}
+
+func (it *rangeIterator) value() float64 {
+	return it.r.start + float64(it.index)*it.r.step
+}
@@ -0,0 +1,113 @@
+package lox
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// stdlibDir is the path of the standard library modules bundled with the
+// interpreter. Modules in it are read from stdlibFiles.
+const stdlibDir = "<stdlib>"
+
+//go:embed stdlib
+var stdlibFiles embed.FS
+
+var libraries []string
+
+// AddLibrary adds a directory to the search path of imports. Libraries are
+// searched in the order they were added and before the LOX_PATH directories.
+func AddLibrary(dir string) {
+	libraries = append(libraries, dir)
+}
+
+func searchPath() []string {
+	dirs := append([]string{}, libraries...)
+	for _, dir := range filepath.SplitList(os.Getenv("LOX_PATH")) {
+		if dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	return append(dirs, stdlibDir)
+}
+
+// findModule returns the canonical path of an imported module. Paths are
+// looked up relative to the importing module first and then in every
+// directory of the search path. Absolute paths and paths starting with
+// './' or '../' are never searched.
+func (i *interpreter) findModule(path string, t token) (string, error) {
+	candidates := []string{path}
+	if !filepath.IsAbs(path) {
+		candidates = []string{filepath.Join(i.module.dir(), path)}
+		if !strings.HasPrefix(path, "./") && !strings.HasPrefix(path, "../") {
+			for _, dir := range searchPath() {
+				candidates = append(candidates, filepath.Join(dir, path))
+			}
+		}
+	}
+	tried := []string{}
+	for _, candidate := range candidates {
+		if canonical, ok := moduleExists(candidate); ok {
+			return canonical, nil
+		}
+		tried = append(tried, "  "+displayPath(candidate))
+	}
+	message := fmt.Sprintf("Could not find module '%s'. Tried:\n%s", path, strings.Join(tried, "\n"))
+	return "", newError(message, t.line)
+}
+
+func moduleExists(path string) (string, bool) {
+	if name, ok := stdlibName(path); ok {
+		info, err := fs.Stat(stdlibFiles, name)
+		return path, err == nil && !info.IsDir()
+	}
+	canonical, err := canonicalPath(path)
+	if err != nil {
+		return "", false
+	}
+	info, err := os.Stat(canonical)
+	return canonical, err == nil && !info.IsDir()
+}
+
+func readModule(path string) ([]byte, error) {
+	if name, ok := stdlibName(path); ok {
+		return stdlibFiles.ReadFile(name)
+	}
+	return os.ReadFile(path)
+}
+
+// stdlibName returns the name of a standard library module in stdlibFiles.
+func stdlibName(path string) (string, bool) {
+	name, ok := strings.CutPrefix(path, stdlibDir+"/")
+	return "stdlib/" + name, ok
+}
+
+// displayPath shortens paths below the working directory for error messages.
+func displayPath(path string) string {
+	if _, ok := stdlibName(path); ok {
+		return path
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return abs
+	}
+	if rel, err := filepath.Rel(wd, abs); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return abs
+}
+
+func canonicalPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(abs)
+}
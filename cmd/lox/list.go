@@ -0,0 +1,205 @@
+package lox
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+type loxList struct {
+	elements []any
+}
+
+type listMethod struct {
+	function func(*interpreter, *loxList, []any, token) (any, error)
+	lenArgs  int
+}
+
+var listMethods = map[string]listMethod{
+	"push":     {function: listPush, lenArgs: 1},
+	"pop":      {function: listPop},
+	"insert":   {function: listInsert, lenArgs: 2},
+	"remove":   {function: listRemove, lenArgs: 1},
+	"len":      {function: listLen},
+	"slice":    {function: listSlice, lenArgs: 2},
+	"contains": {function: listContains, lenArgs: 1},
+	"indexOf":  {function: listIndexOf, lenArgs: 1},
+	"reverse":  {function: listReverse},
+	"join":     {function: listJoin, lenArgs: 1},
+	"sort":     {function: listSort},
+}
+
+func newList(elements []any) *loxList {
+	return &loxList{elements}
+}
+
+func (l *loxList) get(name token) (any, error) {
+	m, ok := listMethods[name.lexeme]
+	if !ok {
+		return nil, newError(fmt.Sprintf("Undefined property '%s'.", name.lexeme), name.line)
+	}
+	function := func(i *interpreter, args []any, t token) (any, error) {
+		return m.function(i, l, args, t)
+	}
+	return &builtin{function: function, lenArgs: m.lenArgs}, nil
+}
+
+func (l *loxList) at(index any, t token) (any, error) {
+	n, err := l.index(index, len(l.elements)-1, t)
+	if err != nil {
+		return nil, err
+	}
+	return l.elements[n], nil
+}
+
+func (l *loxList) setAt(index any, value any, t token) error {
+	n, err := l.index(index, len(l.elements)-1, t)
+	if err != nil {
+		return err
+	}
+	l.elements[n] = value
+	return nil
+}
+
+// index converts a Lox value to a position in the list between 0 and max.
+func (l *loxList) index(val any, max int, t token) (int, error) {
+	n, ok := val.(float64)
+	if !ok || n != math.Trunc(n) {
+		return 0, newError(fmt.Sprintf("List index must be an integer: %v", val), t.line)
+	}
+	if n < 0 {
+		return 0, newError(fmt.Sprintf("List index can't be negative: %v", n), t.line)
+	}
+	if int(n) > max {
+		return 0, newError(fmt.Sprintf("List index out of range: %v", n), t.line)
+	}
+	return int(n), nil
+}
+
+func listPush(_ *interpreter, l *loxList, args []any, _ token) (any, error) {
+	l.elements = append(l.elements, args[0])
+	return float64(len(l.elements)), nil
+}
+
+func listPop(_ *interpreter, l *loxList, _ []any, t token) (any, error) {
+	if len(l.elements) == 0 {
+		return nil, newError("pop - List is empty.", t.line)
+	}
+	last := l.elements[len(l.elements)-1]
+	l.elements = l.elements[:len(l.elements)-1]
+	return last, nil
+}
+
+func listInsert(_ *interpreter, l *loxList, args []any, t token) (any, error) {
+	index, err := l.index(args[0], len(l.elements), t)
+	if err != nil {
+		return nil, err
+	}
+	l.elements = append(l.elements, nil)
+	copy(l.elements[index+1:], l.elements[index:])
+	l.elements[index] = args[1]
+	return nil, nil
+}
+
+func listRemove(_ *interpreter, l *loxList, args []any, t token) (any, error) {
+	index, err := l.index(args[0], len(l.elements)-1, t)
+	if err != nil {
+		return nil, err
+	}
+	removed := l.elements[index]
+	l.elements = append(l.elements[:index], l.elements[index+1:]...)
+	return removed, nil
+}
+
+func listLen(_ *interpreter, l *loxList, _ []any, _ token) (any, error) {
+	return float64(len(l.elements)), nil
+}
+
+func listSlice(_ *interpreter, l *loxList, args []any, t token) (any, error) {
+	start, err := l.index(args[0], len(l.elements), t)
+	if err != nil {
+		return nil, err
+	}
+	end, err := l.index(args[1], len(l.elements), t)
+	if err != nil {
+		return nil, err
+	}
+	if end < start {
+		return nil, newError("slice - End must not be smaller than start.", t.line)
+	}
+	elements := make([]any, end-start)
+	copy(elements, l.elements[start:end])
+	return newList(elements), nil
+}
+
+func listContains(i *interpreter, l *loxList, args []any, t token) (any, error) {
+	index, err := listIndexOf(i, l, args, t)
+	if err != nil {
+		return nil, err
+	}
+	return index.(float64) != -1, nil
+}
+
+func listIndexOf(i *interpreter, l *loxList, args []any, t token) (any, error) {
+	for index, element := range l.elements {
+		equal, err := i.isEqual(element, args[0], t)
+		if err != nil {
+			return nil, err
+		}
+		if equal {
+			return float64(index), nil
+		}
+	}
+	return float64(-1), nil
+}
+
+func listReverse(_ *interpreter, l *loxList, _ []any, _ token) (any, error) {
+	for a, b := 0, len(l.elements)-1; a < b; a, b = a+1, b-1 {
+		l.elements[a], l.elements[b] = l.elements[b], l.elements[a]
+	}
+	return l, nil
+}
+
+func listJoin(i *interpreter, l *loxList, args []any, t token) (any, error) {
+	separator, ok := args[0].(string)
+	if !ok {
+		return nil, newError("join - Separator must be a string.", t.line)
+	}
+	s := make([]string, len(l.elements))
+	for index, element := range l.elements {
+		str, err := i.stringify(element)
+		if err != nil {
+			return nil, err
+		}
+		s[index] = str
+	}
+	return strings.Join(s, separator), nil
+}
+
+func listSort(_ *interpreter, l *loxList, _ []any, t token) (any, error) {
+	allNumbers, allStrings := true, true
+	for _, element := range l.elements {
+		switch element.(type) {
+		case float64:
+			allStrings = false
+		case string:
+			allNumbers = false
+		default:
+			allNumbers, allStrings = false, false
+		}
+	}
+	switch {
+	case allNumbers:
+		sort.SliceStable(l.elements, func(a, b int) bool {
+			return l.elements[a].(float64) < l.elements[b].(float64)
+		})
+	case allStrings:
+		sort.SliceStable(l.elements, func(a, b int) bool {
+			return l.elements[a].(string) < l.elements[b].(string)
+		})
+	default:
+		return nil, newError("sort - List must contain only numbers or only strings.", t.line)
+	}
+	return l, nil
+}
@@ -0,0 +1,111 @@
+package lox
+
+import (
+	"fmt"
+	"slices"
+)
+
+type loxMap struct {
+	keys   []any
+	values map[any]any
+}
+
+type mapMethod struct {
+	function func(*interpreter, *loxMap, []any, token) (any, error)
+	lenArgs  int
+}
+
+var mapMethods = map[string]mapMethod{
+	"keys":    {function: mapKeys},
+	"values":  {function: mapValues},
+	"has":     {function: mapHas, lenArgs: 1},
+	"remove":  {function: mapRemove, lenArgs: 1},
+	"len":     {function: mapLen},
+	"entries": {function: mapEntries},
+}
+
+func newMap() *loxMap {
+	return &loxMap{[]any{}, make(map[any]any)}
+}
+
+func (m *loxMap) get(name token) (any, error) {
+	method, ok := mapMethods[name.lexeme]
+	if !ok {
+		return nil, newError(fmt.Sprintf("Undefined property '%s'.", name.lexeme), name.line)
+	}
+	function := func(i *interpreter, args []any, t token) (any, error) {
+		return method.function(i, m, args, t)
+	}
+	return &builtin{function: function, lenArgs: method.lenArgs}, nil
+}
+
+func (m *loxMap) at(key any, t token) (any, error) {
+	if err := m.checkKey(key, t); err != nil {
+		return nil, err
+	}
+	return m.values[key], nil
+}
+
+func (m *loxMap) setAt(key any, value any, t token) error {
+	if err := m.checkKey(key, t); err != nil {
+		return err
+	}
+	if _, ok := m.values[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = value
+	return nil
+}
+
+func (m *loxMap) checkKey(key any, t token) error {
+	switch key.(type) {
+	case string, float64, bool:
+		return nil
+	}
+	return newError("Map key must be a string, number or boolean.", t.line)
+}
+
+func mapKeys(_ *interpreter, m *loxMap, _ []any, _ token) (any, error) {
+	return newList(slices.Clone(m.keys)), nil
+}
+
+func mapValues(_ *interpreter, m *loxMap, _ []any, _ token) (any, error) {
+	values := make([]any, len(m.keys))
+	for index, key := range m.keys {
+		values[index] = m.values[key]
+	}
+	return newList(values), nil
+}
+
+func mapHas(_ *interpreter, m *loxMap, args []any, t token) (any, error) {
+	if err := m.checkKey(args[0], t); err != nil {
+		return nil, err
+	}
+	_, ok := m.values[args[0]]
+	return ok, nil
+}
+
+func mapRemove(_ *interpreter, m *loxMap, args []any, t token) (any, error) {
+	if err := m.checkKey(args[0], t); err != nil {
+		return nil, err
+	}
+	value, ok := m.values[args[0]]
+	if !ok {
+		return nil, nil
+	}
+	delete(m.values, args[0])
+	m.keys = slices.DeleteFunc(m.keys, func(key any) bool { return key == args[0] })
+	return value, nil
+}
+
+func mapLen(_ *interpreter, m *loxMap, _ []any, _ token) (any, error) {
+	return float64(len(m.keys)), nil
+}
+
+func mapEntries(_ *interpreter, m *loxMap, _ []any, _ token) (any, error) {
+	entries := make([]any, len(m.keys))
+	for index, key := range m.keys {
+		entries[index] = newList([]any{key, m.values[key]})
+	}
+	return newList(entries), nil
+}
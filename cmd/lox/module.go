@@ -0,0 +1,109 @@
+package lox
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// loxModule is a Lox file executed with its own globals. Only the names
+// declared with 'export' can be accessed from other modules.
+type loxModule struct {
+	path     string
+	globals  *globalTable
+	exports  map[string]bool
+	importer *loxModule
+	loading  bool
+}
+
+func newModule(path string, builtins *globalTable, importer *loxModule) *loxModule {
+	return &loxModule{path, newGlobalTable(builtins), make(map[string]bool), importer, true}
+}
+
+func (m *loxModule) String() string { return "<module " + m.name() + ">" }
+
+func (m *loxModule) name() string {
+	return strings.TrimSuffix(filepath.Base(m.path), ".lox")
+}
+
+// dir is the directory imports of the module are resolved against.
+func (m *loxModule) dir() string {
+	return filepath.Dir(m.path)
+}
+
+func (m *loxModule) get(name token) (any, error) {
+	if !m.exports[name.lexeme] {
+		return nil, newError(fmt.Sprintf("Module '%s' has no export '%s'.", m.name(), name.lexeme), name.line)
+	}
+	return m.globals.values[name.lexeme], nil
+}
+
+// importModule returns the module found for the given path and executes it
+// with run if it wasn't imported before.
+func (i *interpreter) importModule(path string, t token, run func(*loxModule, []stmt) error) (*loxModule, error) {
+	canonical, err := i.findModule(path, t)
+	if err != nil {
+		return nil, err
+	}
+	if m, ok := i.modules[canonical]; ok {
+		if m.loading {
+			return nil, i.importCycle(m, t)
+		}
+		return m, nil
+	}
+	content, err := readModule(canonical)
+	if err != nil {
+		return nil, newError(fmt.Sprintf("Could not read module '%s'.", path), t.line)
+	}
+	m := newModule(canonical, i.builtins, i.module)
+	stmts, err := i.parseModule(m, string(content), t)
+	if err != nil {
+		return nil, err
+	}
+	i.modules[canonical] = m
+	importer := i.module
+	i.module = m
+	err = run(m, stmts)
+	i.module = importer
+	if err != nil {
+		// allow importing the module again after a failed attempt
+		delete(i.modules, m.path)
+		return nil, err
+	}
+	m.loading = false
+	return m, nil
+}
+
+// parseModule parses and resolves the content of a module.
+func (i *interpreter) parseModule(m *loxModule, content string, t token) ([]stmt, error) {
+	p := newParser(content)
+	stmts, errs := p.parse()
+	if len(errs) > 0 {
+		message := []string{fmt.Sprintf("Could not parse module '%s':", m.name())}
+		for _, err := range errs {
+			message = append(message, err.String())
+		}
+		return nil, newError(strings.Join(message, "\n"), t.line)
+	}
+	if err := i.resolveAll(stmts); err != nil {
+		return nil, err
+	}
+	return stmts, nil
+}
+
+func (i *interpreter) runModule(m *loxModule, stmts []stmt) error {
+	env := i.environment
+	i.environment = newGlobalEnvironment(m.globals)
+	err := i.interpret(stmts)
+	i.environment = env
+	return err
+}
+
+func (i *interpreter) importCycle(m *loxModule, t token) error {
+	cycle := []string{filepath.Base(m.path)}
+	for importer := i.module; importer != m; importer = importer.importer {
+		cycle = append([]string{filepath.Base(importer.path)}, cycle...)
+	}
+	cycle = append([]string{filepath.Base(m.path)}, cycle...)
+	return newError("Import cycle: "+strings.Join(cycle, " -> ")+".", t.line)
+}
@@ -0,0 +1,103 @@
+package lox
+
+import "fmt"
+
+// operatorMethods are the methods instances can define to overload the
+// operators. The comparisons are derived from __lt__ and __eq__.
+var operatorMethods = map[string]string{
+	PLUS:        "__add__",
+	MINUS:       "__sub__",
+	STAR:        "__mul__",
+	SLASH:       "__div__",
+	LESS:        "__lt__",
+	EQUAL_EQUAL: "__eq__",
+}
+
+// specialMethod returns the method called name of value, bound to it, if value
+// is an instance of either engine defining it.
+func specialMethod(value any, name string) callable {
+	switch value := value.(type) {
+	case *loxInstance:
+		if method := value.findMethod(name); method != nil {
+			return method.bind(value)
+		}
+	case *vmInstance:
+		if method := value.class.findMethod(name); method != nil {
+			return &vmBoundMethod{value, method}
+		}
+	}
+	return nil
+}
+
+func isInstance(value any) bool {
+	switch value.(type) {
+	case *loxInstance, *vmInstance:
+		return true
+	}
+	return false
+}
+
+// overload calls the method overloading the operator when the left operand
+// defines it.
+func (i *interpreter) overload(left any, operator token, right any) (any, bool, error) {
+	name := operatorMethods[operator.tokenType]
+	method := specialMethod(left, name)
+	if method == nil {
+		return nil, false, nil
+	}
+	result, err := i.callSpecial(name, method, []any{right}, operator)
+	return result, true, err
+}
+
+// compare evaluates comparison operators for instances defining __lt__. The
+// other comparisons assume a total order and also use __eq__.
+func (i *interpreter) compare(left any, operator token, right any) (any, bool, error) {
+	less := specialMethod(left, operatorMethods[LESS])
+	if less == nil {
+		return nil, false, nil
+	}
+	result, err := i.callSpecial(operatorMethods[LESS], less, []any{right}, operator)
+	if err != nil {
+		return nil, true, err
+	}
+	isLess := isTruthy(result)
+	switch operator.tokenType {
+	case LESS:
+		return isLess, true, nil
+	case LESS_EQUAL:
+		if isLess {
+			return true, true, nil
+		}
+		equal, err := i.isEqual(left, right, operator)
+		return equal, true, err
+	case GREATER:
+		if isLess {
+			return false, true, nil
+		}
+		equal, err := i.isEqual(left, right, operator)
+		return !equal, true, err
+	}
+	return !isLess, true, nil
+}
+
+func (i *interpreter) callSpecial(name string, method callable, args []any, t token) (any, error) {
+	if !acceptsArgs(method, len(args)) {
+		message := fmt.Sprintf("%s must have %d parameter(s).", name, len(args))
+		return nil, newError(message, t.line)
+	}
+	return method.call(i, args, t)
+}
+
+// instanceIndex makes instances defining __index__ indexable.
+type instanceIndex struct {
+	interpreter *interpreter
+	method      callable
+}
+
+func (o *instanceIndex) at(index any, t token) (any, error) {
+	return o.interpreter.callSpecial("__index__", o.method, []any{index}, t)
+}
+
+func (o *instanceIndex) setAt(_ any, _ any, t token) error {
+	return newError("Can't assign to an index of an instance.", t.line)
+}
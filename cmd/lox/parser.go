@@ -10,6 +10,11 @@ type parser struct {
 	program     []stmt
 	parseErrors []loxError
 	current     int
+	// yields is set when the function being parsed contains 'yield'.
+	yields bool
+	// panicMode is set by a syntax error until synchronize skips the rest of
+	// the declaration it is in. Errors following it aren't reported.
+	panicMode bool
 }
 
 func newParser(str string) *parser {
@@ -28,40 +33,99 @@ func (p *parser) expression() expression {
 	return p.assignment()
 }
 
+// declaration parses a declaration or a statement, and resynchronizes after
+// a syntax error in it.
 func (p *parser) declaration() stmt {
+	defer func() {
+		if p.panicMode {
+			p.synchronize()
+		}
+	}()
 	if p.match(CLASS) {
 		return p.classDeclaration()
 	}
-	if p.match(FUN) {
+	if p.check(FUN) && p.checkNext(IDENTIFIER) {
+		p.advance()
 		return p.function("function")
 	}
 	if p.match(VAR) {
 		return p.varDeclaration()
 	}
+	if p.match(IMPORT) {
+		return p.importDeclaration()
+	}
+	if p.match(EXPORT) {
+		return p.exportDeclaration()
+	}
 	return p.statement()
 }
 
 func (p *parser) classDeclaration() stmt {
 	name := p.consume(IDENTIFIER, "Expected class name.")
-	var methods []*stmtFun
+	var superclass *expressionVar
+	if p.match(LESS) {
+		p.consume(IDENTIFIER, "Expected superclass name.")
+		superclass = &expressionVar{&exp{nil, nil, p.previous()}}
+	}
+	class := &stmtClass{name: name, superclass: superclass}
 	p.consume(LEFT_BRACE, "Expected '{' before class body.")
 	for !p.check(RIGHT_BRACE) && !p.isAtEnd() {
-		methods = append(methods, p.function("method").(*stmtFun))
+		if !p.isStatic() {
+			class.methods = append(class.methods, p.function("method").(*stmtFun))
+			continue
+		}
+		p.advance()
+		if p.checkNext(EQUAL) || p.checkNext(SEMICOLON) {
+			class.staticFields = append(class.staticFields, p.varDeclaration().(*stmtVar))
+		} else {
+			class.staticMethods = append(class.staticMethods, p.function("method").(*stmtFun))
+		}
 	}
 	p.consume(RIGHT_BRACE, "Expected '}' after class body.")
-	return &stmtClass{name, methods}
+	return class
+}
+
+// isStatic reports whether the next class member is declared with a 'class'
+// or 'static' prefix.
+func (p *parser) isStatic() bool {
+	static := p.check(CLASS) || (p.check(IDENTIFIER) && p.peek().lexeme == "static")
+	return static && p.checkNext(IDENTIFIER)
 }
 
 func (p *parser) function(kind string) stmt {
 	name := p.consume(IDENTIFIER, "Expected "+kind+" name.")
-	p.consume(LEFT_PAREN, "Expected '(' after "+kind+" name.")
-	params := []token{}
+	getter := kind == "method" && p.check(LEFT_BRACE)
+	var params paramList
+	if !getter {
+		p.consume(LEFT_PAREN, "Expected '(' after "+kind+" name.")
+		params = p.parameters()
+	}
+	p.consume(LEFT_BRACE, "Expect '{' before "+kind+" body.")
+	body, generator := p.functionBody()
+	return &stmtFun{name, body, params, generator, getter}
+}
+
+func (p *parser) parameters() paramList {
+	list := paramList{}
 	getParam := func() {
-		if len(params) >= 255 {
+		if len(list.params) >= 255 {
 			err := newError("Can't have more than 255 parameters.", p.peek().line)
 			p.parseErrors = append(p.parseErrors, err)
 		}
-		params = append(params, p.consume(IDENTIFIER, "Expected parameter name."))
+		if list.variadic {
+			err := newError("Rest parameter must be the last parameter.", p.peek().line)
+			p.parseErrors = append(p.parseErrors, err)
+		}
+		list.variadic = p.match(DOT_DOT_DOT)
+		list.params = append(list.params, p.consume(IDENTIFIER, "Expected parameter name."))
+		var value expression
+		if !list.variadic && p.match(EQUAL) {
+			value = p.expression()
+		} else if !list.variadic && len(list.defaults) > 0 && list.defaults[len(list.defaults)-1] != nil {
+			err := newError("Parameter without default value can't follow one with a default.", p.previous().line)
+			p.parseErrors = append(p.parseErrors, err)
+		}
+		list.defaults = append(list.defaults, value)
 	}
 	if !p.check(RIGHT_PAREN) {
 		for getParam(); p.match(COMMA); {
@@ -69,9 +133,7 @@ func (p *parser) function(kind string) stmt {
 		}
 	}
 	p.consume(RIGHT_PAREN, "Expect ')' after parameters.")
-	p.consume(LEFT_BRACE, "Expect '{' before "+kind+" body.")
-	body := p.blockStmt()
-	return &stmtFun{name, body, params}
+	return list
 }
 
 func (p *parser) varDeclaration() stmt {
@@ -84,6 +146,40 @@ func (p *parser) varDeclaration() stmt {
 	return &stmtVar{initializer, name}
 }
 
+func (p *parser) importDeclaration() stmt {
+	keyword := p.previous()
+	names := []token{}
+	if p.match(LEFT_BRACE) {
+		getName := func() {
+			names = append(names, p.consume(IDENTIFIER, "Expected name to import."))
+		}
+		for getName(); p.match(COMMA); {
+			getName()
+		}
+		p.consume(RIGHT_BRACE, "Expected '}' after imported names.")
+		if !p.matchWord("from") {
+			err := newError("Expected 'from' after imported names.", p.previous().line)
+			p.parseErrors = append(p.parseErrors, err)
+		}
+	}
+	path := p.consume(STRING, "Expected module path.")
+	var alias token
+	if len(names) == 0 && p.matchWord("as") {
+		alias = p.consume(IDENTIFIER, "Expected module name after 'as'.")
+	}
+	p.consume(SEMICOLON, "Expected ';' after import.")
+	return &stmtImport{path, alias, names, keyword}
+}
+
+func (p *parser) exportDeclaration() stmt {
+	keyword := p.previous()
+	if !p.check(CLASS) && !p.check(VAR) && !(p.check(FUN) && p.checkNext(IDENTIFIER)) {
+		err := newError("Expected declaration after 'export'.", keyword.line)
+		p.parseErrors = append(p.parseErrors, err)
+	}
+	return &stmtExport{p.declaration(), keyword}
+}
+
 func (p *parser) statement() stmt {
 	if p.match(FOR) {
 		return p.forStmt()
@@ -97,7 +193,27 @@ func (p *parser) statement() stmt {
 	if p.match(WHILE) {
 		return p.whileStmt()
 	}
-	if p.match(LEFT_BRACE) {
+	if p.match(TRY) {
+		return p.tryStmt()
+	}
+	if p.match(THROW) {
+		return p.throwStmt()
+	}
+	if p.match(YIELD) {
+		return p.yieldStmt()
+	}
+	if p.match(BREAK) {
+		keyword := p.previous()
+		p.consume(SEMICOLON, "Expected ';' after 'break'.")
+		return &stmtBreak{keyword}
+	}
+	if p.match(CONTINUE) {
+		keyword := p.previous()
+		p.consume(SEMICOLON, "Expected ';' after 'continue'.")
+		return &stmtContinue{keyword}
+	}
+	if p.check(LEFT_BRACE) && !p.isMapLiteral() {
+		p.advance()
 		return p.blockStmt()
 	}
 	expr := p.expression()
@@ -106,7 +222,11 @@ func (p *parser) statement() stmt {
 }
 
 func (p *parser) forStmt() stmt {
+	keyword := p.previous()
 	p.consume(LEFT_PAREN, "Expect '(' after 'for'.")
+	if p.isForIn() {
+		return p.forInStmt(keyword)
+	}
 	var initializer stmt
 	if p.match(SEMICOLON) {
 		initializer = nil
@@ -126,20 +246,35 @@ func (p *parser) forStmt() stmt {
 	}
 	p.consume(RIGHT_PAREN, "Expect ')' after for clauses.")
 	body := p.statement()
-	if increment != nil {
-		body = &stmtBlock{[]stmt{body, &stmtExpr{increment}}}
-	}
 	if condition == nil {
-		exprTrue := &exp{nil, nil, token{TRUE, "true", "true", p.peek().line}}
+		exprTrue := &exp{nil, nil, newToken(TRUE, "true", "true", p.peek().line)}
 		condition = &expressionLiteral{exprTrue, true}
 	}
-	body = &stmtWhile{condition, body}
+	body = &stmtWhile{condition, body, increment}
 	if initializer != nil {
-		body = &stmtBlock{[]stmt{initializer, body}}
+		body = &stmtBlock{statements: []stmt{initializer, body}}
 	}
 	return body
 }
 
+func (p *parser) isForIn() bool {
+	if !p.check(VAR) || !p.checkNext(IDENTIFIER) || p.current+2 >= len(p.tokens) {
+		return false
+	}
+	in := p.tokens[p.current+2]
+	return in.tokenType == IDENTIFIER && in.lexeme == "in"
+}
+
+func (p *parser) forInStmt(keyword token) stmt {
+	p.advance()
+	name := p.consume(IDENTIFIER, "Expected variable name.")
+	p.advance()
+	iterable := p.expression()
+	p.consume(RIGHT_PAREN, "Expect ')' after for clauses.")
+	body := p.statement()
+	return &stmtForIn{name, iterable, body, keyword}
+}
+
 func (p *parser) ifStmt() stmt {
 	p.consume(LEFT_PAREN, "Expect '(' after 'if'.")
 	condition := p.expression()
@@ -161,12 +296,51 @@ func (p *parser) returnStmt() stmt {
 	return &stmtReturn{val, p.previous()}
 }
 
+func (p *parser) tryStmt() stmt {
+	p.consume(LEFT_BRACE, "Expect '{' after 'try'.")
+	try := &stmtTry{body: p.blockStmt()}
+	if p.match(CATCH) {
+		p.consume(LEFT_PAREN, "Expect '(' after 'catch'.")
+		try.catchName = p.consume(IDENTIFIER, "Expected error variable name.")
+		p.consume(RIGHT_PAREN, "Expect ')' after error variable name.")
+		p.consume(LEFT_BRACE, "Expect '{' before catch body.")
+		try.catchBody = p.blockStmt()
+	}
+	if p.match(FINALLY) {
+		p.consume(LEFT_BRACE, "Expect '{' after 'finally'.")
+		try.finallyBody = p.blockStmt()
+	}
+	if try.catchBody == nil && try.finallyBody == nil {
+		err := newError("Expected 'catch' or 'finally' after try block.", p.previous().line)
+		p.parseErrors = append(p.parseErrors, err)
+	}
+	return try
+}
+
+func (p *parser) throwStmt() stmt {
+	keyword := p.previous()
+	val := p.expression()
+	p.consume(SEMICOLON, "Expected ';' after thrown value.")
+	return &stmtThrow{val, keyword}
+}
+
+func (p *parser) yieldStmt() stmt {
+	keyword := p.previous()
+	p.yields = true
+	var val expression
+	if !p.check(SEMICOLON) {
+		val = p.expression()
+	}
+	p.consume(SEMICOLON, "Expected ';' after yielded value.")
+	return &stmtYield{val, keyword}
+}
+
 func (p *parser) whileStmt() stmt {
 	p.consume(LEFT_PAREN, "Expect '(' after 'while'.")
 	condition := p.expression()
 	p.consume(RIGHT_PAREN, "Expect ')' after condition.")
 	body := p.statement()
-	return &stmtWhile{condition, body}
+	return &stmtWhile{condition, body, nil}
 }
 
 func (p *parser) blockStmt() stmt {
@@ -175,11 +349,11 @@ func (p *parser) blockStmt() stmt {
 		stmts = append(stmts, p.declaration())
 	}
 	p.consume(RIGHT_BRACE, "Expected '}' after block.")
-	return &stmtBlock{stmts}
+	return &stmtBlock{statements: stmts}
 }
 
 func (p *parser) assignment() expression {
-	expr := p.or()
+	expr := p.ternary()
 	if p.match(EQUAL) {
 		operator := p.previous()
 		value := p.assignment()
@@ -189,10 +363,49 @@ func (p *parser) assignment() expression {
 			return &expressionAssignment{exp}
 		case *expressionGet:
 			return &expressionSet{expr.expression, value, expr.name}
+		case *expressionIndex:
+			return &expressionIndexSet{expr.expression, expr.index, value, expr.bracket}
 		}
 		err := newError("Invalid assignment target.", p.peek().line)
 		p.parseErrors = append(p.parseErrors, err)
 	}
+	if p.match(PLUS_EQUAL, MINUS_EQUAL, STAR_EQUAL, SLASH_EQUAL, PERCENT_EQUAL) {
+		operator := p.previous()
+		value := p.assignment()
+		return p.compound(expr, operator, value, false)
+	}
+	return expr
+}
+
+func (p *parser) compound(target expression, operator token, value expression, postfix bool) expression {
+	switch target.(type) {
+	case *expressionVar, *expressionGet, *expressionIndex:
+		return newCompound(target, operator, value, postfix)
+	}
+	err := newError("Invalid assignment target.", operator.line)
+	p.parseErrors = append(p.parseErrors, err)
+	return target
+}
+
+func (p *parser) ternary() expression {
+	expr := p.nilCoalescing()
+	if p.match(QUESTION) {
+		operator := p.previous()
+		thenBranch := p.expression()
+		p.consume(COLON, "Expected ':' after then branch of conditional expression.")
+		elseBranch := p.ternary()
+		return &expressionTernary{&exp{expr, thenBranch, operator}, elseBranch}
+	}
+	return expr
+}
+
+func (p *parser) nilCoalescing() expression {
+	expr := p.or()
+	for p.match(QUESTION_QUESTION) {
+		operator := p.previous()
+		right := p.or()
+		expr = &expressionLogical{&exp{expr, right, operator}}
+	}
 	return expr
 }
 
@@ -227,39 +440,68 @@ func (p *parser) equality() expression {
 }
 
 func (p *parser) comparison() expression {
-	expr := p.term()
+	expr := p.bitwiseOr()
 	for p.match(GREATER, GREATER_EQUAL, LESS, LESS_EQUAL) {
 		operator := p.previous()
-		right := p.term()
+		right := p.bitwiseOr()
 		expr = &expressionComparison{&exp{expr, right, operator}}
 	}
 	return expr
 }
 
-func (p *parser) term() expression {
-	expr := p.factor()
-	for p.match(PLUS) {
+func (p *parser) bitwiseOr() expression {
+	expr := p.bitwiseXor()
+	for p.match(PIPE) {
 		operator := p.previous()
-		right := p.factor()
-		expr = &expressionTerm{&exp{expr, right, operator}}
+		right := p.bitwiseXor()
+		expr = &expressionBitwise{&exp{expr, right, operator}}
 	}
-	for p.match(MINUS) {
+	return expr
+}
+
+func (p *parser) bitwiseXor() expression {
+	expr := p.bitwiseAnd()
+	for p.match(CARET) {
+		operator := p.previous()
+		right := p.bitwiseAnd()
+		expr = &expressionBitwise{&exp{expr, right, operator}}
+	}
+	return expr
+}
+
+func (p *parser) bitwiseAnd() expression {
+	expr := p.shift()
+	for p.match(AMPERSAND) {
+		operator := p.previous()
+		right := p.shift()
+		expr = &expressionBitwise{&exp{expr, right, operator}}
+	}
+	return expr
+}
+
+func (p *parser) shift() expression {
+	expr := p.term()
+	for p.match(LESS_LESS, GREATER_GREATER) {
+		operator := p.previous()
+		right := p.term()
+		expr = &expressionBitwise{&exp{expr, right, operator}}
+	}
+	return expr
+}
+
+func (p *parser) term() expression {
+	expr := p.factor()
+	for p.match(PLUS, MINUS) {
 		operator := p.previous()
 		right := p.factor()
 		expr = &expressionTerm{&exp{expr, right, operator}}
 	}
-
 	return expr
 }
 
 func (p *parser) factor() expression {
 	expr := p.unary()
-	for p.match(STAR) {
-		operator := p.previous()
-		right := p.unary()
-		expr = &expressionFactor{&exp{expr, right, operator}}
-	}
-	for p.match(SLASH) {
+	for p.match(STAR, SLASH, PERCENT, TILDE_SLASH) {
 		operator := p.previous()
 		right := p.unary()
 		expr = &expressionFactor{&exp{expr, right, operator}}
@@ -268,36 +510,78 @@ func (p *parser) factor() expression {
 }
 
 func (p *parser) unary() expression {
-	if p.match(BANG) {
+	if p.match(BANG, MINUS, TILDE) {
 		operator := p.previous()
 		right := p.unary()
 		return &expressionUnary{&exp{nil, right, operator}}
 	}
-	if p.match(MINUS) {
+	if p.match(PLUS_PLUS, MINUS_MINUS) {
+		operator := p.previous()
+		target := p.unary()
+		return p.compound(target, operator, nil, false)
+	}
+	return p.power()
+}
+
+// power is right-associative and binds tighter than unary operators on its
+// left, so -2 ** 2 is -(2 ** 2) while 2 ** -1 is 2 ** (-1).
+func (p *parser) power() expression {
+	expr := p.postfix()
+	if p.match(STAR_STAR) {
 		operator := p.previous()
 		right := p.unary()
-		return &expressionUnary{&exp{nil, right, operator}}
+		expr = &expressionPower{&exp{expr, right, operator}}
 	}
+	return expr
+}
 
-	return p.call()
+func (p *parser) postfix() expression {
+	expr := p.call()
+	if p.match(PLUS_PLUS, MINUS_MINUS) {
+		return p.compound(expr, p.previous(), nil, true)
+	}
+	return expr
 }
 
 func (p *parser) call() expression {
 	expr := p.primary()
+	optional := false
 	for {
 		if p.match(LEFT_PAREN) {
-			expr = p.finishCall(expr)
+			expr = p.finishCall(expr, false)
 		} else if p.match(DOT) {
 			name := p.consume(IDENTIFIER, "Expect property name after '.'.")
-			expr = &expressionGet{expr, name}
+			expr = &expressionGet{expr, name, false}
+		} else if p.match(LEFT_BRACKET) {
+			expr = p.finishIndex(expr, false)
+		} else if p.match(QUESTION_DOT) {
+			optional = true
+			if p.match(LEFT_PAREN) {
+				expr = p.finishCall(expr, true)
+			} else if p.match(LEFT_BRACKET) {
+				expr = p.finishIndex(expr, true)
+			} else {
+				name := p.consume(IDENTIFIER, "Expect property name after '?.'.")
+				expr = &expressionGet{expr, name, true}
+			}
 		} else {
 			break
 		}
 	}
+	if optional {
+		expr = &expressionOptional{expr}
+	}
 	return expr
 }
 
-func (p *parser) finishCall(callee expression) expression {
+func (p *parser) finishIndex(object expression, optional bool) expression {
+	bracket := p.previous()
+	index := p.expression()
+	p.consume(RIGHT_BRACKET, "Expected ']' after index.")
+	return &expressionIndex{object, index, bracket, optional}
+}
+
+func (p *parser) finishCall(callee expression, optional bool) expression {
 	args := []expression{}
 	if !p.check(RIGHT_PAREN) {
 		for {
@@ -305,14 +589,24 @@ func (p *parser) finishCall(callee expression) expression {
 				err := newError("Can't have more than 255 arguments.", p.peek().line)
 				p.parseErrors = append(p.parseErrors, err)
 			}
-			args = append(args, p.expression())
+			args = append(args, p.argument())
 			if !p.match(COMMA) {
 				break
 			}
 		}
 	}
 	p.consume(RIGHT_PAREN, "Expect ')' after arguments.")
-	return &expressionCall{callee, args}
+	return &expressionCall{callee, args, optional}
+}
+
+// argument parses an element of an argument list or list literal, which
+// can be spread with '...'.
+func (p *parser) argument() expression {
+	if p.match(DOT_DOT_DOT) {
+		dots := p.previous()
+		return &expressionSpread{&exp{p.expression(), nil, dots}}
+	}
+	return p.expression()
 }
 
 func (p *parser) primary() expression {
@@ -333,19 +627,166 @@ func (p *parser) primary() expression {
 		val := p.previous().literal
 		return &expressionLiteral{&exp{nil, nil, p.previous()}, val}
 	}
+	if p.match(INTERPOLATION) {
+		return p.interpolation()
+	}
+	if p.match(SUPER) {
+		keyword := p.previous()
+		p.consume(DOT, "Expected '.' after 'super'.")
+		method := p.consume(IDENTIFIER, "Expected superclass method name.")
+		return &expressionSuper{&exp{nil, nil, keyword}, method}
+	}
+	if p.match(THIS) {
+		return &expressionThis{&exp{nil, nil, p.previous()}}
+	}
+	if p.check(IDENTIFIER) && p.checkNext(ARROW) {
+		param := p.peek()
+		p.advance()
+		return p.arrowFunction(param, paramList{params: []token{param}, defaults: []expression{nil}})
+	}
 	if p.match(IDENTIFIER) {
 		return &expressionVar{&exp{nil, nil, p.previous()}}
 	}
+	if p.match(LEFT_BRACKET) {
+		return p.list()
+	}
+	if p.match(LEFT_BRACE) {
+		return p.mapLiteral()
+	}
+	if p.match(FUN) {
+		return p.lambda()
+	}
+	if p.check(LEFT_PAREN) && p.isArrowFunction() {
+		paren := p.peek()
+		p.advance()
+		return p.arrowFunction(paren, p.parameters())
+	}
 	if p.match(LEFT_PAREN) {
-		expr := &expressionGroup{p.equality()}
+		expr := &expressionGroup{p.expression()}
 		p.consume(RIGHT_PAREN, "Unmatched parenthesis.")
 		return expr
 	}
-	err := newError("at '"+p.peek().lexeme+"' - Expected expression.", p.peek().line)
-	p.parseErrors = append(p.parseErrors, err)
+	p.syntaxError(newError("at '"+p.peek().lexeme+"' - Expected expression.", p.peek().line))
+	// skip the token so parsing moves on, unless it ends the statement
+	if !p.check(SEMICOLON) {
+		p.advance()
+	}
 	return nil
 }
 
+func (p *parser) list() expression {
+	bracket := p.previous()
+	elements := []expression{}
+	if !p.check(RIGHT_BRACKET) {
+		for elements = append(elements, p.argument()); p.match(COMMA); {
+			elements = append(elements, p.argument())
+		}
+	}
+	p.consume(RIGHT_BRACKET, "Expected ']' after list elements.")
+	return &expressionList{&exp{nil, nil, bracket}, elements}
+}
+
+func (p *parser) interpolation() expression {
+	start := p.previous()
+	parts := []expression{}
+	for {
+		parts = append(parts, &expressionLiteral{&exp{nil, nil, p.previous()}, p.previous().literal})
+		parts = append(parts, p.expression())
+		if !p.match(INTERPOLATION) {
+			break
+		}
+	}
+	p.consume(STRING, "Expected '}' after interpolated expression.")
+	parts = append(parts, &expressionLiteral{&exp{nil, nil, p.previous()}, p.previous().literal})
+	return &expressionInterpolation{&exp{nil, nil, start}, parts}
+}
+
+func (p *parser) lambda() expression {
+	keyword := p.previous()
+	p.consume(LEFT_PAREN, "Expected '(' after 'fun'.")
+	params := p.parameters()
+	p.consume(LEFT_BRACE, "Expect '{' before function body.")
+	body, generator := p.functionBody()
+	name := newToken(IDENTIFIER, "anonymous", NULL, keyword.line)
+	return &expressionLambda{&exp{nil, nil, keyword}, &stmtFun{name, body, params, generator, false}}
+}
+
+// arrowFunction parses the rest of an arrow function starting at start,
+// whose parameters are either a parenthesized list or a single name like in
+// 'x => x * 2'.
+func (p *parser) arrowFunction(start token, params paramList) expression {
+	arrow := p.consume(ARROW, "Expected '=>' after parameters.")
+	var body stmt
+	generator := false
+	if p.check(LEFT_BRACE) && !p.isMapLiteral() {
+		p.advance()
+		body, generator = p.functionBody()
+	} else {
+		body = &stmtBlock{statements: []stmt{&stmtReturn{p.assignment(), arrow}}}
+	}
+	name := newToken(IDENTIFIER, "anonymous", NULL, start.line)
+	return &expressionLambda{&exp{nil, nil, start}, &stmtFun{name, body, params, generator, false}}
+}
+
+// functionBody parses the block of a function after its '{' and reports
+// whether it contains 'yield', which makes the function a generator.
+func (p *parser) functionBody() (stmt, bool) {
+	enclosing := p.yields
+	p.yields = false
+	body := p.blockStmt()
+	generator := p.yields
+	p.yields = enclosing
+	return body, generator
+}
+
+// isArrowFunction reports whether the '(' at the current position starts the
+// parameter list of an arrow function like '(a, b) => a + b'.
+func (p *parser) isArrowFunction() bool {
+	depth := 0
+	for n := p.current; n < len(p.tokens); n++ {
+		switch p.tokens[n].tokenType {
+		case LEFT_PAREN:
+			depth++
+		case RIGHT_PAREN:
+			depth--
+			if depth == 0 {
+				return n+1 < len(p.tokens) && p.tokens[n+1].tokenType == ARROW
+			}
+		}
+	}
+	return false
+}
+
+func (p *parser) mapLiteral() expression {
+	brace := p.previous()
+	keys, values := []expression{}, []expression{}
+	getEntry := func() {
+		keys = append(keys, p.expression())
+		p.consume(COLON, "Expected ':' after map key.")
+		values = append(values, p.expression())
+	}
+	if !p.check(RIGHT_BRACE) {
+		for getEntry(); p.match(COMMA); {
+			getEntry()
+		}
+	}
+	p.consume(RIGHT_BRACE, "Expected '}' after map entries.")
+	return &expressionMap{&exp{nil, nil, brace}, keys, values}
+}
+
+// isMapLiteral reports whether the '{' at the start of a statement opens a
+// map literal instead of a block, which is the case for '{ key:'.
+func (p *parser) isMapLiteral() bool {
+	if p.current+2 >= len(p.tokens) {
+		return false
+	}
+	switch p.tokens[p.current+1].tokenType {
+	case STRING, NUMBER, TRUE, FALSE:
+		return p.tokens[p.current+2].tokenType == COLON
+	}
+	return false
+}
+
 /////////////////////
 /// Helper methods///
 /////////////////////
@@ -385,29 +826,52 @@ func (p *parser) check(t string) bool {
 	return p.peek().tokenType == t
 }
 
+func (p *parser) checkNext(t string) bool {
+	if p.isAtEnd() || p.current+1 >= len(p.tokens) {
+		return false
+	}
+	return p.tokens[p.current+1].tokenType == t
+}
+
+// matchWord matches an identifier used as a keyword in some places only,
+// like 'as' and 'from' in imports.
+func (p *parser) matchWord(word string) bool {
+	if p.check(IDENTIFIER) && p.peek().lexeme == word {
+		p.advance()
+		return true
+	}
+	return false
+}
+
 func (p *parser) consume(t string, err string) token {
 	if p.peek().tokenType == t {
 		p.advance()
 		return p.previous()
 	}
-	p.parseErrors = append(p.parseErrors, newError(err, p.previous().line))
+	p.syntaxError(newError(err, p.previous().line))
 	return token{}
 }
 
+// syntaxError reports err unless it follows another syntax error in the same
+// declaration.
+func (p *parser) syntaxError(err loxError) {
+	if !p.panicMode {
+		p.parseErrors = append(p.parseErrors, err)
+	}
+	p.panicMode = true
+}
+
+// synchronize skips the rest of a declaration with a syntax error, up to the
+// end of its statement, the keyword starting the next one or the end of the
+// enclosing block.
 func (p *parser) synchronize() {
-	p.advance()
+	p.panicMode = false
 	for !p.isAtEnd() {
 		if p.previous().tokenType == SEMICOLON {
 			return
 		}
 		switch p.peek().tokenType {
-		case CLASS:
-		case FUN:
-		case VAR:
-		case FOR:
-		case IF:
-		case WHILE:
-		case RETURN:
+		case CLASS, FUN, VAR, FOR, IF, WHILE, RETURN, RIGHT_BRACE:
 			return
 		}
 		p.advance()
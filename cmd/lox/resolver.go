@@ -11,19 +11,54 @@ const (
 	none fnType = iota
 	function
 	method
+	initializer
 )
 
+type classType int
+
+const (
+	noClass classType = iota
+	class
+	subclass
+)
+
+// variable is a local variable declared in a scope. It is stored in the
+// environment of the scope at slot, in the order of the declarations.
+type variable struct {
+	slot    int
+	defined bool
+}
+
+type scope map[string]*variable
+
 type resolver struct {
-	interpreter *interpreter
-	scopes      *list.List
-	currentFun  fnType
+	interpreter  *interpreter
+	scopes       *list.List
+	currentFun   fnType
+	currentClass classType
+	loopDepth    int
+	inGenerator  bool
 }
 
 func newResolver(i *interpreter) *resolver {
-	r := resolver{i, list.New(), none}
+	r := resolver{i, list.New(), none, noClass, 0, false}
 	return &r
 }
 
+// resolveAll resolves the statements of a script and returns the first error
+// found, after which the resolver can be used again.
+func (r *resolver) resolveAll(stmts []stmt) (err error) {
+	defer func() {
+		if err != nil {
+			r.scopes.Init()
+			r.currentFun, r.currentClass, r.loopDepth, r.inGenerator = none, noClass, 0, false
+		}
+	}()
+	defer recoverError(&err)
+	r.resolve(stmts)
+	return nil
+}
+
 func (r *resolver) resolve(stmts []stmt) {
 	for _, s := range stmts {
 		r.resolveStmt(s)
@@ -42,119 +77,261 @@ func (r *resolver) resolveExpr(e expression) {
 	}
 }
 
-func (r *resolver) visitClassStmt(stmt *stmtClass) {
+func (r *resolver) visitClassStmt(stmt *stmtClass) completion {
+	enclosingClass := r.currentClass
+	defer func() { r.currentClass = enclosingClass }()
 	r.declare(stmt.name)
 	r.define(stmt.name)
+	for _, field := range stmt.staticFields {
+		r.resolveExpr(field.initializer)
+	}
+	r.currentClass = class
+	if stmt.superclass != nil {
+		if stmt.superclass.lexeme() == stmt.name.lexeme {
+			err := newError("A class can't inherit from itself.", stmt.superclass.token().line)
+			panic(err)
+		}
+		r.currentClass = subclass
+		r.resolveExpr(stmt.superclass)
+		r.beginScope()
+		r.declareImplicit("super")
+	}
+	r.beginScope()
+	r.declareImplicit("this")
 	for _, m := range stmt.methods {
+		if m.name.lexeme == "init" {
+			if m.getter {
+				err := newError("Initializer must have a parameter list.", m.name.line)
+				panic(err)
+			}
+			r.resolveFunction(initializer, m)
+		} else {
+			r.resolveFunction(method, m)
+		}
+	}
+	for _, m := range stmt.staticMethods {
 		r.resolveFunction(method, m)
 	}
+	r.endScope()
+	if stmt.superclass != nil {
+		r.endScope()
+	}
+	return completion{}
 }
 
-func (r *resolver) visitFunStmt(stmt *stmtFun) {
+func (r *resolver) visitFunStmt(stmt *stmtFun) completion {
 	r.declare(stmt.name)
 	r.define(stmt.name)
 	r.resolveFunction(function, stmt)
+	return completion{}
 }
 
 func (r *resolver) resolveFunction(t fnType, stmt *stmtFun) {
-	enclosingFn := r.currentFun
-	defer func() { r.currentFun = enclosingFn }()
-	r.currentFun = t
+	enclosingFn, enclosingLoopDepth, enclosingGenerator := r.currentFun, r.loopDepth, r.inGenerator
+	defer func() { r.currentFun, r.loopDepth, r.inGenerator = enclosingFn, enclosingLoopDepth, enclosingGenerator }()
+	r.currentFun, r.loopDepth, r.inGenerator = t, 0, stmt.generator
 	r.beginScope()
-	for _, param := range stmt.params {
+	for index, param := range stmt.params {
+		if value := stmt.defaults[index]; value != nil {
+			r.resolveExpr(value)
+		}
 		r.declare(param)
 		r.define(param)
 	}
-	r.resolveStmt(stmt.body)
-	r.endScope()
+	body := stmt.body.(*stmtBlock)
+	r.resolve(body.statements)
+	body.size = r.endScope()
 }
 
-func (r *resolver) visitVarStmt(stmt *stmtVar) {
+func (r *resolver) visitVarStmt(stmt *stmtVar) completion {
 	r.declare(stmt.name)
 	if stmt.initializer != nil {
 		r.resolveExpr(stmt.initializer)
 	}
 	r.define(stmt.name)
+	return completion{}
 }
 
 func (r *resolver) declare(name token) {
 	if r.scopes.Len() == 0 {
 		return
 	}
-	scope := r.scopes.Back().Value.(map[string]bool)
+	scope := r.scopes.Back().Value.(scope)
 	if _, ok := scope[name.lexeme]; ok {
 		err := newError(fmt.Sprintf("Identifier '%s' already declared in this scope.", name.lexeme), name.line)
 		panic(err)
 	}
-	scope[name.lexeme] = false
+	scope[name.lexeme] = &variable{len(scope), false}
 }
 
 func (r *resolver) define(name token) {
 	if r.scopes.Len() == 0 {
 		return
 	}
-	scope := r.scopes.Back().Value.(map[string]bool)
-	scope[name.lexeme] = true
+	r.scopes.Back().Value.(scope)[name.lexeme].defined = true
 }
 
-func (r *resolver) visitIfStmt(stmt *stmtIf) {
+// declareImplicit declares 'this' or 'super' in the innermost scope.
+func (r *resolver) declareImplicit(name string) {
+	scope := r.scopes.Back().Value.(scope)
+	scope[name] = &variable{len(scope), true}
+}
+
+func (r *resolver) visitIfStmt(stmt *stmtIf) completion {
 	r.resolveExpr(stmt.condition)
 	r.resolveStmt(stmt.thenBranch)
 	if stmt.elseBranch != nil {
 		r.resolveStmt(stmt.elseBranch)
 	}
+	return completion{}
 }
 
-func (r *resolver) visitReturnStmt(stmt *stmtReturn) {
+func (r *resolver) visitReturnStmt(stmt *stmtReturn) completion {
 	if r.currentFun == none {
 		err := newError("Can't return from top-level code.", stmt.line)
 		panic(err)
 	}
 	if stmt.value != nil {
+		if r.currentFun == initializer {
+			err := newError("Can't return a value from an initializer.", stmt.line)
+			panic(err)
+		}
+		if r.inGenerator {
+			err := newError("Can't return a value from a generator.", stmt.line)
+			panic(err)
+		}
 		r.resolveExpr(stmt.value)
 	}
+	return completion{}
 }
 
-func (r *resolver) visitWhileStmt(stmt *stmtWhile) {
+func (r *resolver) visitWhileStmt(stmt *stmtWhile) completion {
 	r.resolveExpr(stmt.condition)
+	r.loopDepth++
 	r.resolveStmt(stmt.body)
+	r.loopDepth--
+	r.resolveExpr(stmt.increment)
+	return completion{}
 }
 
-func (r *resolver) visitBlockStmt(stmt *stmtBlock) {
+func (r *resolver) visitForInStmt(stmt *stmtForIn) completion {
+	r.resolveExpr(stmt.iterable)
 	r.beginScope()
-	r.resolve(stmt.statements)
+	r.declare(stmt.name)
+	r.define(stmt.name)
+	r.loopDepth++
+	r.resolveStmt(stmt.body)
+	r.loopDepth--
 	r.endScope()
+	return completion{}
+}
+
+func (r *resolver) visitTryStmt(stmt *stmtTry) completion {
+	r.resolveStmt(stmt.body)
+	if stmt.catchBody != nil {
+		r.beginScope()
+		r.declare(stmt.catchName)
+		r.define(stmt.catchName)
+		catchBody := stmt.catchBody.(*stmtBlock)
+		r.resolve(catchBody.statements)
+		catchBody.size = r.endScope()
+	}
+	r.resolveStmt(stmt.finallyBody)
+	return completion{}
+}
+
+func (r *resolver) visitThrowStmt(stmt *stmtThrow) completion {
+	r.resolveExpr(stmt.value)
+	return completion{}
+}
+
+func (r *resolver) visitYieldStmt(stmt *stmtYield) completion {
+	if r.currentFun == none {
+		err := newError("Can't yield from top-level code.", stmt.line)
+		panic(err)
+	}
+	if r.currentFun == initializer {
+		err := newError("Can't yield from an initializer.", stmt.line)
+		panic(err)
+	}
+	r.resolveExpr(stmt.value)
+	return completion{}
+}
+
+func (r *resolver) visitBreakStmt(stmt *stmtBreak) completion {
+	if r.loopDepth == 0 {
+		err := newError("Can't use 'break' outside of a loop.", stmt.line)
+		panic(err)
+	}
+	return completion{}
+}
+
+func (r *resolver) visitContinueStmt(stmt *stmtContinue) completion {
+	if r.loopDepth == 0 {
+		err := newError("Can't use 'continue' outside of a loop.", stmt.line)
+		panic(err)
+	}
+	return completion{}
+}
+
+func (r *resolver) visitImportStmt(stmt *stmtImport) completion {
+	if r.scopes.Len() > 0 {
+		err := newError("Can only import at the top level.", stmt.line)
+		panic(err)
+	}
+	return completion{}
+}
+
+func (r *resolver) visitExportStmt(stmt *stmtExport) completion {
+	if r.scopes.Len() > 0 {
+		err := newError("Can only export top-level declarations.", stmt.line)
+		panic(err)
+	}
+	r.resolveStmt(stmt.declaration)
+	return completion{}
+}
+
+func (r *resolver) visitBlockStmt(stmt *stmtBlock) completion {
+	r.beginScope()
+	r.resolve(stmt.statements)
+	stmt.size = r.endScope()
+	return completion{}
 }
 
 func (r *resolver) beginScope() {
-	r.scopes.PushBack(map[string]bool{})
+	r.scopes.PushBack(scope{})
 }
 
-func (r *resolver) endScope() {
-	r.scopes.Remove(r.scopes.Back())
+// endScope ends the innermost scope and returns the number of variables
+// declared in it.
+func (r *resolver) endScope() int {
+	return len(r.scopes.Remove(r.scopes.Back()).(scope))
 }
 
-func (r *resolver) visitExprStmt(stmt *stmtExpr) {
+func (r *resolver) visitExprStmt(stmt *stmtExpr) completion {
 	r.resolveExpr(stmt.initializer)
+	return completion{}
 }
 
-func (r *resolver) visitVar(expr *expressionVar) any {
+func (r *resolver) visitVar(expr *expressionVar) (any, error) {
 	if r.scopes.Len() > 0 {
-		hasValue, ok := r.scopes.Back().Value.(map[string]bool)[expr.lexeme()]
-		if r.scopes.Len() > 0 && ok && !hasValue {
+		v, ok := r.scopes.Back().Value.(scope)[expr.lexeme()]
+		if ok && !v.defined {
 			err := newError(fmt.Sprintf("Can't access '%s' in its own initializer.", expr.lexeme()), expr.token().line)
 			panic(err)
 		}
 	}
-	r.resolveLocal(expr)
-	return nil
+	r.resolveLocal(expr, expr.lexeme())
+	return nil, nil
 }
 
-func (r *resolver) resolveLocal(expr expression) {
+// resolveLocal resolves the variable name used by expr, which is global if
+// no enclosing scope declares it.
+func (r *resolver) resolveLocal(expr expression, name string) {
 	for i := r.scopes.Len() - 1; i >= 0; i-- {
-		scope := getNthOfList(r.scopes, i).Value.(map[string]bool)
-		if _, ok := scope[expr.lexeme()]; ok {
-			r.interpreter.resolve(expr, r.scopes.Len()-1-i)
+		scope := getNthOfList(r.scopes, i).Value.(scope)
+		if v, ok := scope[name]; ok {
+			r.interpreter.resolve(expr, r.scopes.Len()-1-i, v.slot)
 			return
 		}
 	}
@@ -168,67 +345,160 @@ func getNthOfList(l *list.List, n int) *list.Element {
 	return e
 }
 
-func (r *resolver) visitAssignment(expr *expressionAssignment) any {
+func (r *resolver) visitAssignment(expr *expressionAssignment) (any, error) {
 	r.resolveExpr(expr.next())
-	r.resolveLocal(expr)
-	return nil
+	r.resolveLocal(expr, expr.expr().lexeme())
+	return nil, nil
 }
 
-func (r *resolver) visitSet(expr *expressionSet) any {
+func (r *resolver) visitSet(expr *expressionSet) (any, error) {
 	r.resolveExpr(expr.expression)
 	r.resolveExpr(expr.value)
-	return nil
+	return nil, nil
+}
+
+func (r *resolver) visitCompound(expr *expressionCompound) (any, error) {
+	r.resolveExpr(expr.expression)
+	r.resolveExpr(expr.value)
+	return nil, nil
+}
+
+func (r *resolver) visitLogical(expr *expressionLogical) (any, error) {
+	return r.defaultResolver(expr)
 }
 
-func (r *resolver) visitLogical(expr *expressionLogical) any {
+func (r *resolver) visitEquality(expr *expressionEquality) (any, error) {
 	return r.defaultResolver(expr)
 }
 
-func (r *resolver) visitEquality(expr *expressionEquality) any {
+func (r *resolver) visitComparison(expr *expressionComparison) (any, error) {
 	return r.defaultResolver(expr)
 }
 
-func (r *resolver) visitComparison(expr *expressionComparison) any {
+func (r *resolver) visitTerm(expr *expressionTerm) (any, error) {
 	return r.defaultResolver(expr)
 }
 
-func (r *resolver) visitTerm(expr *expressionTerm) any {
+func (r *resolver) visitFactor(expr *expressionFactor) (any, error) {
 	return r.defaultResolver(expr)
 }
 
-func (r *resolver) visitFactor(expr *expressionFactor) any {
+func (r *resolver) visitPower(expr *expressionPower) (any, error) {
 	return r.defaultResolver(expr)
 }
 
-func (r *resolver) visitUnary(expr *expressionUnary) any {
+func (r *resolver) visitBitwise(expr *expressionBitwise) (any, error) {
+	return r.defaultResolver(expr)
+}
+
+func (r *resolver) visitUnary(expr *expressionUnary) (any, error) {
 	r.resolveExpr(expr.next())
-	return nil
+	return nil, nil
 }
 
-func (r *resolver) visitGet(expr *expressionGet) any {
+func (r *resolver) visitGet(expr *expressionGet) (any, error) {
 	r.resolveExpr(expr.expression)
-	return nil
+	return nil, nil
+}
+
+func (r *resolver) visitIndex(expr *expressionIndex) (any, error) {
+	r.resolveExpr(expr.expression)
+	r.resolveExpr(expr.index)
+	return nil, nil
 }
 
-func (r *resolver) visitCall(expr *expressionCall) any {
+func (r *resolver) visitIndexSet(expr *expressionIndexSet) (any, error) {
+	r.resolveExpr(expr.expression)
+	r.resolveExpr(expr.index)
+	r.resolveExpr(expr.value)
+	return nil, nil
+}
+
+func (r *resolver) visitCall(expr *expressionCall) (any, error) {
 	r.resolveExpr(expr.expression)
 	for _, arg := range expr.args {
 		r.resolveExpr(arg)
 	}
-	return nil
+	return nil, nil
+}
+
+func (r *resolver) visitSpread(expr *expressionSpread) (any, error) {
+	r.resolveExpr(expr.expr())
+	return nil, nil
+}
+
+func (r *resolver) visitList(expr *expressionList) (any, error) {
+	for _, element := range expr.elements {
+		r.resolveExpr(element)
+	}
+	return nil, nil
+}
+
+func (r *resolver) visitMap(expr *expressionMap) (any, error) {
+	for index, key := range expr.keys {
+		r.resolveExpr(key)
+		r.resolveExpr(expr.values[index])
+	}
+	return nil, nil
+}
+
+func (r *resolver) visitInterpolation(expr *expressionInterpolation) (any, error) {
+	for _, part := range expr.parts {
+		r.resolveExpr(part)
+	}
+	return nil, nil
 }
 
-func (r *resolver) visitLiteral(expr *expressionLiteral) any { return nil }
+func (r *resolver) visitLambda(expr *expressionLambda) (any, error) {
+	r.resolveFunction(function, expr.function)
+	return nil, nil
+}
 
-func (r *resolver) visitGroup(expr *expressionGroup) any {
+func (r *resolver) visitSuper(expr *expressionSuper) (any, error) {
+	if r.currentClass == noClass {
+		err := newError("Can't use 'super' outside of a class.", expr.token().line)
+		panic(err)
+	}
+	if r.currentClass != subclass {
+		err := newError("Can't use 'super' in a class with no superclass.", expr.token().line)
+		panic(err)
+	}
+	r.resolveLocal(expr, expr.lexeme())
+	return nil, nil
+}
+
+func (r *resolver) visitThis(expr *expressionThis) (any, error) {
+	if r.currentClass == noClass {
+		err := newError("Can't use 'this' outside of a class.", expr.token().line)
+		panic(err)
+	}
+	r.resolveLocal(expr, expr.lexeme())
+	return nil, nil
+}
+
+func (r *resolver) visitOptional(expr *expressionOptional) (any, error) {
 	r.resolveExpr(expr.expression)
-	return nil
+	return nil, nil
 }
 
-func (r *resolver) visitExpr(expr *exp) any { return nil }
+func (r *resolver) visitTernary(expr *expressionTernary) (any, error) {
+	r.resolveExpr(expr.expr())
+	r.resolveExpr(expr.next())
+	r.resolveExpr(expr.elseBranch)
+	return nil, nil
+}
+
+func (r *resolver) visitLiteral(expr *expressionLiteral) (any, error) { return nil, nil }
 
-func (r *resolver) defaultResolver(expr expression) any {
+func (r *resolver) visitGroup(expr *expressionGroup) (any, error) {
+	r.resolveExpr(expr.expression)
+	return nil, nil
+}
+
+func (r *resolver) visitExpr(expr *exp) (any, error) { return nil, nil }
+
+func (r *resolver) defaultResolver(expr expression) (any, error) {
 	r.resolveExpr(expr.expr())
 	r.resolveExpr(expr.next())
-	return nil
+	return nil, nil
 }
@@ -2,143 +2,357 @@ package lox
 
 import (
 	"fmt"
-	"regexp"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
-type regexRule struct {
-	handler func(string)
-	regex   string
+// keywords maps the reserved words to their token types.
+var keywords = map[string]string{
+	"and":      AND,
+	"break":    BREAK,
+	"catch":    CATCH,
+	"class":    CLASS,
+	"continue": CONTINUE,
+	"else":     ELSE,
+	"export":   EXPORT,
+	"false":    FALSE,
+	"finally":  FINALLY,
+	"for":      FOR,
+	"fun":      FUN,
+	"if":       IF,
+	"import":   IMPORT,
+	"nil":      NIL,
+	"or":       OR,
+	"return":   RETURN,
+	"super":    SUPER,
+	"this":     THIS,
+	"throw":    THROW,
+	"true":     TRUE,
+	"try":      TRY,
+	"var":      VAR,
+	"while":    WHILE,
+	"yield":    YIELD,
 }
 
+// scanner turns the source into tokens in a single pass over its bytes.
+// Every token takes the longest sequence of characters it can match.
 type scanner struct {
-	specCharTokenTypes map[string]string
-	buffer             string
-	tokens             []token
-	scanErrors         []loxError
-	regexRules         []regexRule
-	keywords           []string
-	specialChars       []string
-	current            int
-	line               int
+	buffer         string
+	tokens         []token
+	scanErrors     []loxError
+	interpolations []int
+	// start is the offset of the token being scanned and current the offset
+	// of the next character.
+	start     int
+	current   int
+	line      int
+	lineStart int
+}
+
+func newScanner(str string) *scanner {
+	return &scanner{buffer: str}
 }
 
 func (s *scanner) tokenize() ([]token, []loxError) {
 	s.tokens, s.scanErrors = []token{}, []loxError{}
 	s.current = 0
 	s.line = 1
-outer:
+	s.lineStart = 0
+	s.interpolations = []int{}
 	for s.current < len(s.buffer) {
-		found := false
-		for _, rule := range s.regexRules {
-			r := regexp.MustCompile(`^` + rule.regex)
-			loc := r.FindIndex([]byte(s.buffer[s.current:]))
-			if len(loc) == 0 {
-				continue
-			}
-			val := s.buffer[s.current : s.current+loc[1]]
-			found = true
-			rule.handler(val)
-			s.current += len(val)
-			continue outer
-		}
-		if !found {
-			next := s.buffer[s.current : s.current+1]
-			if next == `"` {
-				s.scanErrors = append(s.scanErrors, newError("Unterminated string.", s.line))
-				s.current++
-				break outer
-			} else {
-				s.scanErrors = append(s.scanErrors, newError(fmt.Sprintf("Unexpected character: %s", next), s.line))
+		s.start = s.current
+		s.scanToken()
+	}
+	if len(s.interpolations) > 0 {
+		s.scanErrors = append(s.scanErrors, newError("Unterminated string interpolation.", s.line))
+	}
+	s.start = s.current
+	s.addToken(EOF, NULL)
+	return s.tokens, s.scanErrors
+}
+
+func (s *scanner) scanToken() {
+	if s.isStringStart() {
+		s.stringHandler()
+		return
+	}
+	c := s.buffer[s.current]
+	s.current++
+	switch c {
+	case ' ', '\t', '\r', '\f':
+	case '\n':
+		s.line++
+		s.lineStart = s.current
+	case '(':
+		s.addToken(LEFT_PAREN, NULL)
+	case ')':
+		s.addToken(RIGHT_PAREN, NULL)
+	case '{':
+		s.nest(1)
+		s.addToken(LEFT_BRACE, NULL)
+	case '}':
+		s.nest(-1)
+		s.addToken(RIGHT_BRACE, NULL)
+	case '[':
+		s.addToken(LEFT_BRACKET, NULL)
+	case ']':
+		s.addToken(RIGHT_BRACKET, NULL)
+	case ';':
+		s.addToken(SEMICOLON, NULL)
+	case ',':
+		s.addToken(COMMA, NULL)
+	case ':':
+		s.addToken(COLON, NULL)
+	case '&':
+		s.addToken(AMPERSAND, NULL)
+	case '|':
+		s.addToken(PIPE, NULL)
+	case '^':
+		s.addToken(CARET, NULL)
+	case '!':
+		s.addToken(s.choose(BANG, "=", BANG_EQUAL), NULL)
+	case '=':
+		s.addToken(s.choose(EQUAL, "=", EQUAL_EQUAL, ">", ARROW), NULL)
+	case '<':
+		s.addToken(s.choose(LESS, "<", LESS_LESS, "=", LESS_EQUAL), NULL)
+	case '>':
+		s.addToken(s.choose(GREATER, ">", GREATER_GREATER, "=", GREATER_EQUAL), NULL)
+	case '?':
+		s.addToken(s.choose(QUESTION, "?", QUESTION_QUESTION, ".", QUESTION_DOT), NULL)
+	case '*':
+		s.addToken(s.choose(STAR, "*", STAR_STAR, "=", STAR_EQUAL), NULL)
+	case '.':
+		s.addToken(s.choose(DOT, "..", DOT_DOT_DOT), NULL)
+	case '+':
+		s.addToken(s.choose(PLUS, "=", PLUS_EQUAL, "+", PLUS_PLUS), NULL)
+	case '-':
+		s.addToken(s.choose(MINUS, "=", MINUS_EQUAL, "-", MINUS_MINUS), NULL)
+	case '%':
+		s.addToken(s.choose(PERCENT, "=", PERCENT_EQUAL), NULL)
+	case '~':
+		s.addToken(s.choose(TILDE, "/", TILDE_SLASH), NULL)
+	case '/':
+		if s.match("/") {
+			for s.current < len(s.buffer) && s.buffer[s.current] != '\n' {
 				s.current++
 			}
+			return
+		}
+		s.addToken(s.choose(SLASH, "=", SLASH_EQUAL), NULL)
+	default:
+		switch {
+		case isAlpha(c):
+			s.identifier()
+		case isDigit(c):
+			s.number()
+		default:
+			r, size := utf8.DecodeRuneInString(s.buffer[s.start:])
+			s.current = s.start + size
+			err := newError(fmt.Sprintf("Unexpected character: %c", r), s.line)
+			s.scanErrors = append(s.scanErrors, err)
 		}
 	}
-	s.tokens = append(s.tokens, newToken(EOF, "", NULL, s.line))
-	return s.tokens, s.scanErrors
 }
 
-func (s *scanner) defaultHandler(val string) {
-	s.tokens = append(s.tokens, newToken(strings.ToUpper(val), val, NULL, s.line))
+// choose returns the token type paired with the first of the following
+// characters that comes next and consumes them, or tokenType if none does.
+func (s *scanner) choose(tokenType string, pairs ...string) string {
+	for n := 0; n < len(pairs); n += 2 {
+		if s.match(pairs[n]) {
+			return pairs[n+1]
+		}
+	}
+	return tokenType
 }
 
-func (s *scanner) whitespaceHandler(val string) {
-	if val == "\n" {
-		s.line++
+func (s *scanner) match(next string) bool {
+	if !strings.HasPrefix(s.buffer[s.current:], next) {
+		return false
+	}
+	s.current += len(next)
+	return true
+}
+
+// nest tracks the braces inside an interpolated expression, so its closing
+// '}' can be told apart from the ones of the expression.
+func (s *scanner) nest(delta int) {
+	if depth := len(s.interpolations); depth > 0 {
+		s.interpolations[depth-1] += delta
+	}
+}
+
+func (s *scanner) addToken(tokenType string, literal string) {
+	s.appendToken(newToken(tokenType, s.buffer[s.start:s.current], literal, s.line))
+}
+
+func (s *scanner) appendToken(t token) {
+	t.column = s.column(s.start, s.lineStart)
+	s.tokens = append(s.tokens, t)
+}
+
+// column returns the column of the character at offset in the line starting
+// at offset lineStart of the buffer, counting characters rather than bytes.
+func (s *scanner) column(offset int, lineStart int) int {
+	return utf8.RuneCountInString(s.buffer[lineStart:offset]) + 1
+}
+
+func (s *scanner) identifier() {
+	for s.current < len(s.buffer) && (isAlpha(s.buffer[s.current]) || isDigit(s.buffer[s.current])) {
+		s.current++
+	}
+	if tokenType, ok := keywords[s.buffer[s.start:s.current]]; ok {
+		s.addToken(tokenType, NULL)
+		return
 	}
+	s.addToken(IDENTIFIER, NULL)
 }
 
-func (s *scanner) specialCharHandler(val string) {
-	s.tokens = append(s.tokens, newToken(s.specCharTokenTypes[val], val, NULL, s.line))
+// number scans an integer or a decimal number. Its literal always has a
+// fractional part without trailing zeros, like 1.0 or 1.5.
+func (s *scanner) number() {
+	s.digits()
+	if s.current+1 < len(s.buffer) && s.buffer[s.current] == '.' && isDigit(s.buffer[s.current+1]) {
+		s.current++
+		s.digits()
+	}
+	lexeme := s.buffer[s.start:s.current]
+	literal := lexeme + ".0"
+	if strings.Contains(lexeme, ".") {
+		literal = strings.TrimRight(lexeme, "0")
+		if strings.HasSuffix(literal, ".") {
+			literal += "0"
+		}
+	}
+	s.addToken(NUMBER, literal)
 }
 
-func (s *scanner) stringHandler(val string) {
-	linesSkipped := len(regexp.MustCompile(`\n`).FindAllString(val, len(val)))
-	s.line += linesSkipped
-	s.tokens = append(s.tokens, newToken(STRING, val, val[1:len(val)-1], s.line))
+func (s *scanner) digits() {
+	for s.current < len(s.buffer) && isDigit(s.buffer[s.current]) {
+		s.current++
+	}
+}
+
+func isAlpha(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// isStringStart reports whether a string literal starts at the current
+// position, or continues after the '}' closing an interpolated expression.
+func (s *scanner) isStringStart() bool {
+	if s.buffer[s.current] == '"' {
+		return true
+	}
+	depth := len(s.interpolations)
+	return s.buffer[s.current] == '}' && depth > 0 && s.interpolations[depth-1] == 0
 }
 
-func (s *scanner) identifierHandler(val string) {
-	for _, keyword := range s.keywords {
-		if strings.ToLower(keyword) == val {
-			s.defaultHandler(val)
+// stringHandler scans a string literal up to its closing quote. A '${' ends
+// the current part with an INTERPOLATION token, and the embedded expression
+// is tokenized as usual until its closing '}' resumes the string.
+func (s *scanner) stringHandler() {
+	start := s.current
+	if s.buffer[start] == '}' {
+		s.interpolations = s.interpolations[:len(s.interpolations)-1]
+	}
+	s.current++
+	bodyStart := s.current
+	for s.current < len(s.buffer) {
+		switch {
+		case s.buffer[s.current] == '\\':
+			s.current += 2
+		case s.buffer[s.current] == '"':
+			s.current++
+			s.addString(STRING, start, bodyStart, s.current-1)
 			return
+		case strings.HasPrefix(s.buffer[s.current:], "${"):
+			s.current += 2
+			s.addString(INTERPOLATION, start, bodyStart, s.current-2)
+			s.interpolations = append(s.interpolations, 0)
+			return
+		default:
+			s.current++
 		}
 	}
-	s.tokens = append(s.tokens, newToken(IDENTIFIER, val, NULL, s.line))
+	s.scanErrors = append(s.scanErrors, newError("Unterminated string.", s.line))
+	s.current = len(s.buffer)
 }
 
-func (s *scanner) numberHandler(val string) {
-	addComma := regexp.MustCompile(`(^\d+$)`)
-	literal := addComma.ReplaceAllString(string(val), "$1.0")
-	cutZeros := regexp.MustCompile(`([\d])0*$`)
-	literal = cutZeros.ReplaceAllString(string(literal), "$1")
-	s.tokens = append(s.tokens, newToken(NUMBER, val, literal, s.line))
+func (s *scanner) addString(tokenType string, start int, bodyStart int, bodyEnd int) {
+	lexeme := s.buffer[start:s.current]
+	literal := s.unescape(s.buffer[bodyStart:bodyEnd], bodyStart)
+	s.appendToken(newToken(tokenType, lexeme, literal, s.line))
+	if last := strings.LastIndex(lexeme, "\n"); last != -1 {
+		s.line += strings.Count(lexeme, "\n")
+		s.lineStart = start + last + 1
+	}
 }
 
-func newScanner(str string) *scanner {
-	l := &scanner{buffer: str}
-
-	regexRules := []regexRule{
-		{regex: "//.*", handler: func(_ string) {}},
-		{regex: `\s`, handler: l.whitespaceHandler},
-		{regex: `"[^"]*"`, handler: l.stringHandler},
-		{regex: "[a-zA-Z_][a-zA-Z0-9_]*", handler: l.identifierHandler},
-		{regex: `\d+(\.\d+)?`, handler: l.numberHandler},
-	}
-
-	l.keywords = []string{AND, CLASS, ELSE, FALSE, FOR, FUN, IF, NIL, OR, RETURN, SUPER, THIS, TRUE, VAR, WHILE}
-	for _, keyword := range l.keywords {
-		regexRules = append(regexRules, regexRule{regex: strings.ToLower(keyword), handler: l.defaultHandler})
-	}
-
-	l.specialChars = []string{`\!=`, `==`, `>=`, `<=`, `>`, `<`, `\!`, `=`, `;`, `\(`, `\)`, `{`, `}`, `\*`, `\.`, `,`, `\+`, `-`, `/`}
-	for _, special := range l.specialChars {
-		regexRules = append(regexRules, regexRule{regex: special, handler: l.specialCharHandler})
-	}
-
-	l.regexRules = regexRules
-	l.specCharTokenTypes = map[string]string{
-		"==": EQUAL_EQUAL,
-		"!=": BANG_EQUAL,
-		">=": GREATER_EQUAL,
-		"<=": LESS_EQUAL,
-		">":  GREATER,
-		"<":  LESS,
-		"!":  BANG,
-		"=":  EQUAL,
-		";":  SEMICOLON,
-		"(":  LEFT_PAREN,
-		")":  RIGHT_PAREN,
-		"{":  LEFT_BRACE,
-		"}":  RIGHT_BRACE,
-		"*":  STAR,
-		".":  DOT,
-		",":  COMMA,
-		"+":  PLUS,
-		"-":  MINUS,
-		"/":  SLASH,
-	}
-
-	return l
+// unescape decodes the escape sequences in the body of a string literal,
+// which starts at offset start of the buffer.
+func (s *scanner) unescape(body string, start int) string {
+	var b strings.Builder
+	line, lineStart := s.line, s.lineStart
+	for pos := 0; pos < len(body); pos++ {
+		c := body[pos]
+		if c == '\n' {
+			line++
+			lineStart = start + pos + 1
+		}
+		if c != '\\' {
+			b.WriteByte(c)
+			continue
+		}
+		column := s.column(start+pos, lineStart)
+		pos++
+		switch body[pos] {
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		case '0':
+			b.WriteByte(0)
+		case '"':
+			b.WriteByte('"')
+		case '$':
+			b.WriteByte('$')
+		case '\\':
+			b.WriteByte('\\')
+		case '\n':
+			s.errorAt("Invalid escape sequence at end of line", line, column)
+			line++
+			lineStart = start + pos + 1
+		case 'u':
+			end := strings.IndexByte(body[pos:], '}')
+			if !strings.HasPrefix(body[pos:], "u{") || end == -1 {
+				s.errorAt("Invalid unicode escape sequence", line, column)
+				continue
+			}
+			hex := body[pos+2 : pos+end]
+			r, err := strconv.ParseUint(hex, 16, 32)
+			if err != nil || len(hex) > 6 || !utf8.ValidRune(rune(r)) {
+				s.errorAt(fmt.Sprintf("Invalid unicode escape sequence '\\u{%s}'", hex), line, column)
+			} else {
+				b.WriteRune(rune(r))
+			}
+			pos += end
+		default:
+			_, size := utf8.DecodeRuneInString(body[pos:])
+			s.errorAt(fmt.Sprintf("Invalid escape sequence '\\%s'", body[pos:pos+size]), line, column)
+			pos += size - 1
+		}
+	}
+	return b.String()
+}
+
+// errorAt reports a scan error at a column of a line.
+func (s *scanner) errorAt(message string, line int, column int) {
+	err := newError(fmt.Sprintf("%s at column %d.", message, column), line)
+	s.scanErrors = append(s.scanErrors, err)
 }
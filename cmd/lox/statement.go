@@ -1,18 +1,35 @@
 package lox
 
 type stmt interface {
-	accept(v stmtVisitor)
+	accept(v stmtVisitor) completion
 }
 
 type stmtClass struct {
-	name    token
-	methods []*stmtFun
+	name          token
+	superclass    *expressionVar
+	methods       []*stmtFun
+	staticMethods []*stmtFun
+	staticFields  []*stmtVar
 }
 
 type stmtFun struct {
-	name   token
-	body   stmt
-	params []token
+	name token
+	body stmt
+	paramList
+	// generator is set for functions containing 'yield'.
+	generator bool
+	// getter is set for methods declared without a parameter list, which
+	// run when the property is accessed.
+	getter bool
+}
+
+// paramList holds the parameters of a function with their default values,
+// which are nil for required parameters. If variadic is set, the last
+// parameter collects the remaining arguments in a list.
+type paramList struct {
+	params   []token
+	defaults []expression
+	variadic bool
 }
 
 type stmtVar struct {
@@ -34,44 +51,158 @@ type stmtReturn struct {
 type stmtWhile struct {
 	condition expression
 	body      stmt
+	increment expression
+}
+
+// stmtForIn runs body for every value of iterable, which is bound to a new
+// variable called name in each iteration.
+type stmtForIn struct {
+	name     token
+	iterable expression
+	body     stmt
+	token
+}
+
+type stmtTry struct {
+	body        stmt
+	catchName   token
+	catchBody   stmt
+	finallyBody stmt
+}
+
+type stmtYield struct {
+	value expression
+	token
+}
+
+type stmtThrow struct {
+	value expression
+	token
+}
+
+type stmtBreak struct {
+	token
+}
+
+type stmtContinue struct {
+	token
+}
+
+// stmtImport binds the module at path to alias or its exported names to
+// variables of the same name.
+type stmtImport struct {
+	path  token
+	alias token
+	names []token
+	token
+}
+
+type stmtExport struct {
+	declaration stmt
+	token
 }
 
 type stmtBlock struct {
 	statements []stmt
+	// size is the number of variables declared in the scope of the block,
+	// which is that of the function for function bodies.
+	size int
 }
 
 type stmtExpr struct {
 	initializer expression
 }
 
-func (s *stmtClass) accept(v stmtVisitor) {
-	v.visitClassStmt(s)
+// arity returns the minimum and maximum number of arguments, which is -1 for
+// variadic functions.
+func (p paramList) arity() (int, int) {
+	max := len(p.params)
+	if p.variadic {
+		max--
+	}
+	min := max
+	for min > 0 && p.defaults[min-1] != nil {
+		min--
+	}
+	if p.variadic {
+		return min, -1
+	}
+	return min, max
+}
+
+func (s *stmtClass) accept(v stmtVisitor) completion {
+	return v.visitClassStmt(s)
+}
+
+func (s *stmtFun) accept(v stmtVisitor) completion {
+	return v.visitFunStmt(s)
+}
+
+func (s *stmtVar) accept(v stmtVisitor) completion {
+	return v.visitVarStmt(s)
+}
+
+func (s *stmtIf) accept(v stmtVisitor) completion {
+	return v.visitIfStmt(s)
+}
+
+func (s *stmtReturn) accept(v stmtVisitor) completion {
+	return v.visitReturnStmt(s)
+}
+
+func (s *stmtWhile) accept(v stmtVisitor) completion {
+	return v.visitWhileStmt(s)
+}
+
+func (s *stmtForIn) accept(v stmtVisitor) completion {
+	return v.visitForInStmt(s)
+}
+
+func (s *stmtTry) accept(v stmtVisitor) completion {
+	return v.visitTryStmt(s)
+}
+
+func (s *stmtYield) accept(v stmtVisitor) completion {
+	return v.visitYieldStmt(s)
+}
+
+func (s *stmtThrow) accept(v stmtVisitor) completion {
+	return v.visitThrowStmt(s)
 }
 
-func (s *stmtFun) accept(v stmtVisitor) {
-	v.visitFunStmt(s)
+func (s *stmtBreak) accept(v stmtVisitor) completion {
+	return v.visitBreakStmt(s)
 }
 
-func (s *stmtVar) accept(v stmtVisitor) {
-	v.visitVarStmt(s)
+func (s *stmtContinue) accept(v stmtVisitor) completion {
+	return v.visitContinueStmt(s)
 }
 
-func (s *stmtIf) accept(v stmtVisitor) {
-	v.visitIfStmt(s)
+func (s *stmtImport) accept(v stmtVisitor) completion {
+	return v.visitImportStmt(s)
 }
 
-func (s *stmtReturn) accept(v stmtVisitor) {
-	v.visitReturnStmt(s)
+func (s *stmtExport) accept(v stmtVisitor) completion {
+	return v.visitExportStmt(s)
 }
 
-func (s *stmtWhile) accept(v stmtVisitor) {
-	v.visitWhileStmt(s)
+// name is the name of the exported class, function or variable.
+func (s *stmtExport) name() token {
+	switch declaration := s.declaration.(type) {
+	case *stmtClass:
+		return declaration.name
+	case *stmtFun:
+		return declaration.name
+	case *stmtVar:
+		return declaration.name
+	}
+	return s.token
 }
 
-func (s *stmtBlock) accept(v stmtVisitor) {
-	v.visitBlockStmt(s)
+func (s *stmtBlock) accept(v stmtVisitor) completion {
+	return v.visitBlockStmt(s)
 }
 
-func (s *stmtExpr) accept(v stmtVisitor) {
-	v.visitExprStmt(s)
+func (s *stmtExpr) accept(v stmtVisitor) completion {
+	return v.visitExprStmt(s)
 }
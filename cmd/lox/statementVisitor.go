@@ -1,12 +1,20 @@
 package lox
 
 type stmtVisitor interface {
-	visitClassStmt(stmt *stmtClass)
-	visitFunStmt(stmt *stmtFun)
-	visitVarStmt(stmt *stmtVar)
-	visitIfStmt(stmt *stmtIf)
-	visitReturnStmt(stmt *stmtReturn)
-	visitWhileStmt(stmt *stmtWhile)
-	visitBlockStmt(stmt *stmtBlock)
-	visitExprStmt(stmt *stmtExpr)
+	visitClassStmt(stmt *stmtClass) completion
+	visitFunStmt(stmt *stmtFun) completion
+	visitVarStmt(stmt *stmtVar) completion
+	visitIfStmt(stmt *stmtIf) completion
+	visitReturnStmt(stmt *stmtReturn) completion
+	visitWhileStmt(stmt *stmtWhile) completion
+	visitForInStmt(stmt *stmtForIn) completion
+	visitTryStmt(stmt *stmtTry) completion
+	visitThrowStmt(stmt *stmtThrow) completion
+	visitYieldStmt(stmt *stmtYield) completion
+	visitBreakStmt(stmt *stmtBreak) completion
+	visitContinueStmt(stmt *stmtContinue) completion
+	visitImportStmt(stmt *stmtImport) completion
+	visitExportStmt(stmt *stmtExport) completion
+	visitBlockStmt(stmt *stmtBlock) completion
+	visitExprStmt(stmt *stmtExpr) completion
 }
@@ -5,6 +5,9 @@ type token struct {
 	lexeme    string
 	literal   string
 	line      int
+	// column is the position of the token in its line in characters,
+	// starting at 1.
+	column int
 }
 
 func newToken(tokenType string, lexeme string, literal string, line int) token {
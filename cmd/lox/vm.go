@@ -0,0 +1,1007 @@
+package lox
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// maxFrames limits the depth of calls in the VM.
+const maxFrames = 100000
+
+// vm runs the bytecode of compiled scripts on a value stack. It shares the
+// runtime values and builtins with the tree-walking interpreter, which
+// provides the helpers for strings, equality, iteration and modules.
+type vm struct {
+	i          *interpreter
+	fiber      *vmFiber
+	builtins   *globalTable
+	errorClass *vmClass
+	// trace receives every instruction before it is executed, if set.
+	trace io.Writer
+}
+
+// vmFiber is a stack of calls. Every generator runs its body in a fiber of its
+// own, which is resumed on top of the fiber asking for the next value.
+type vmFiber struct {
+	stack    []any
+	frames   []*vmFrame
+	handlers []vmHandler
+	open     *vmUpvalue
+	parent   *vmFiber
+	yielded  bool
+	// closing is set while a generator is closed, which makes its yields
+	// return.
+	closing bool
+}
+
+type vmFrame struct {
+	closure *vmClosure
+	ip      int
+	// op is the offset of the instruction being executed.
+	op int
+	// slots is the stack index of the callee, followed by the arguments and
+	// the local variables.
+	slots    int
+	argCount int
+	// stash holds the return value while finally blocks run.
+	stash any
+}
+
+// vmHandler is the catch or finally block that an error in a try block
+// jumps to.
+type vmHandler struct {
+	frame   int
+	stack   int
+	target  int
+	finally bool
+}
+
+// finallyJump and finallyThrow are the ways of leaving a finally block other
+// than falling through, which continue once it completed.
+type finallyJump int
+
+type finallyThrow struct {
+	err loxError
+}
+
+func newVM(i *interpreter) *vm {
+	vm := &vm{i: i, fiber: &vmFiber{}}
+	i.vm = vm
+	vm.builtins = &globalTable{nil, globals()}
+	p := newParser(errorClassSource)
+	stmts, _ := p.parse()
+	vm.runScript(&loxModule{globals: vm.builtins, exports: make(map[string]bool)}, stmts)
+	vm.errorClass = vm.builtins.values["Error"].(*vmClass)
+	vm.trace = traceOutput
+	return vm
+}
+
+// interpret runs the top-level code of the script and returns the runtime
+// error that ended it.
+func (vm *vm) interpret(stmts []stmt) error {
+	return vm.runScript(vm.i.module, stmts)
+}
+
+// runScript compiles and runs the top-level code of a module.
+func (vm *vm) runScript(m *loxModule, stmts []stmt) error {
+	function, err := compile(stmts, m)
+	if err != nil {
+		return err
+	}
+	_, err = vm.call(&vmClosure{function, nil}, nil, token{})
+	return err
+}
+
+// call calls a value from Go and runs it to completion.
+func (vm *vm) call(callee any, args []any, t token) (any, error) {
+	f := vm.fiber
+	base, top := len(f.frames), len(f.stack)
+	f.push(callee)
+	for _, arg := range args {
+		f.push(arg)
+	}
+	if err := vm.enter(callee, len(args), t); err != nil {
+		f.stack = f.stack[:top]
+		return nil, err
+	}
+	if len(f.frames) > base {
+		return vm.run(base)
+	}
+	return f.pop(), nil
+}
+
+// run executes the current fiber until the frame at index base returns or
+// the fiber yields. Errors jump to the innermost handler of a try block in
+// these frames, and unwind them otherwise.
+func (vm *vm) run(base int) (any, error) {
+	for {
+		result, err := vm.execute(base)
+		if err == nil {
+			return result, nil
+		}
+		if err := vm.throw(err.(loxError), base); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (vm *vm) execute(base int) (any, error) {
+	f := vm.fiber
+	frame := f.frames[len(f.frames)-1]
+	code := frame.closure.function.chunk.code
+	constants := frame.closure.function.chunk.constants
+	for {
+		if vm.trace != nil {
+			vm.traceInstruction(frame)
+		}
+		frame.op = frame.ip
+		op := opCode(code[frame.ip])
+		frame.ip++
+		switch op {
+		case opConstant:
+			f.push(constants[frame.readShort(code)])
+		case opNil:
+			f.push(nil)
+		case opTrue:
+			f.push(true)
+		case opFalse:
+			f.push(false)
+		case opPop:
+			f.pop()
+		case opDup:
+			f.push(f.peek(0))
+		case opDup2:
+			f.push(f.peek(1))
+			f.push(f.peek(1))
+		case opBury:
+			depth := int(frame.readByte(code))
+			top := len(f.stack) - 1
+			value := f.stack[top]
+			copy(f.stack[top-depth+1:], f.stack[top-depth:top])
+			f.stack[top-depth] = value
+		case opGetLocal:
+			f.push(f.stack[frame.slots+int(frame.readByte(code))])
+		case opSetLocal:
+			f.stack[frame.slots+int(frame.readByte(code))] = f.peek(0)
+		case opGetGlobal:
+			name := constants[frame.readShort(code)].(string)
+			value, err := vm.global(frame, name)
+			if err != nil {
+				return nil, err
+			}
+			f.push(value)
+		case opSetGlobal:
+			name := constants[frame.readShort(code)].(string)
+			if err := vm.setGlobal(frame, name, f.peek(0)); err != nil {
+				return nil, err
+			}
+		case opDefineGlobal:
+			name := constants[frame.readShort(code)].(string)
+			frame.closure.function.module.globals.define(name, f.pop())
+		case opGetUpvalue:
+			f.push(frame.closure.upvalues[frame.readByte(code)].get())
+		case opSetUpvalue:
+			frame.closure.upvalues[frame.readByte(code)].set(f.peek(0))
+		case opCloseUpvalue:
+			f.closeUpvalues(len(f.stack) - 1)
+			f.pop()
+		case opGetProperty:
+			name := vm.name(frame, constants)
+			value, err := vm.getProperty(f.pop(), name, vm.node(frame))
+			if err != nil {
+				return nil, err
+			}
+			f.push(value)
+		case opGetField:
+			name := vm.name(frame, constants)
+			object, err := vm.object(f.pop(), frame)
+			if err != nil {
+				return nil, err
+			}
+			value, err := object.get(vm.i, name)
+			if err != nil {
+				return nil, err
+			}
+			f.push(value)
+		case opSetProperty:
+			name := vm.name(frame, constants)
+			value := f.pop()
+			object, err := vm.object(f.pop(), frame)
+			if err != nil {
+				return nil, err
+			}
+			object.set(name, value)
+			f.push(value)
+		case opGetSuper:
+			name := vm.name(frame, constants)
+			superclass := f.pop().(*vmClass)
+			value, err := vm.super(f.pop(), superclass, name)
+			if err != nil {
+				return nil, err
+			}
+			f.push(value)
+		case opIndex:
+			index := f.pop()
+			bracket := vm.token(frame)
+			object, err := vm.i.toIndexable(f.pop(), bracket)
+			if err != nil {
+				return nil, err
+			}
+			value, err := object.at(index, bracket)
+			if err != nil {
+				return nil, err
+			}
+			f.push(value)
+		case opSetIndex:
+			value, index := f.pop(), f.pop()
+			bracket := vm.token(frame)
+			object, err := vm.i.toIndexable(f.pop(), bracket)
+			if err != nil {
+				return nil, err
+			}
+			if err := object.setAt(index, value, bracket); err != nil {
+				return nil, err
+			}
+			f.push(value)
+		case opEqual, opNotEqual:
+			b, a := f.pop(), f.pop()
+			equal, err := vm.i.isEqual(a, b, vm.token(frame))
+			if err != nil {
+				return nil, err
+			}
+			if op == opNotEqual {
+				equal = !equal
+			}
+			f.push(equal)
+		case opGreater, opGreaterEqual, opLess, opLessEqual:
+			b, a := f.pop(), f.pop()
+			result, err := vm.compare(op, a, b, frame)
+			if err != nil {
+				return nil, err
+			}
+			f.push(result)
+		case opAdd, opSubtract, opMultiply, opDivide, opModulo, opIntDivide:
+			b, a := f.pop(), f.pop()
+			result, err := vm.arithmetic(op, a, b, frame)
+			if err != nil {
+				return nil, err
+			}
+			f.push(result)
+		case opPower:
+			b, a := f.pop(), f.pop()
+			left, right, err := vm.i.numbers(a, b, vm.node(frame))
+			if err != nil {
+				return nil, err
+			}
+			f.push(math.Pow(left, right))
+		case opBitAnd, opBitOr, opBitXor, opShiftLeft, opShiftRight:
+			b, a := f.pop(), f.pop()
+			result, err := vm.bitwise(op, a, b, frame)
+			if err != nil {
+				return nil, err
+			}
+			f.push(result)
+		case opBitNot:
+			n, err := vm.i.integer(f.pop(), vm.node(frame).next())
+			if err != nil {
+				return nil, err
+			}
+			f.push(float64(^n))
+		case opNot:
+			f.push(!isTruthy(f.pop()))
+		case opNegate:
+			value := f.pop()
+			if n, ok := value.(float64); ok {
+				f.push(-n)
+				break
+			}
+			n, err := vm.i.number(value, vm.node(frame).next())
+			if err != nil {
+				return nil, err
+			}
+			f.push(-n)
+		case opJump:
+			offset := frame.readShort(code)
+			frame.ip += offset
+		case opJumpIfFalse:
+			offset := frame.readShort(code)
+			if !isTruthy(f.peek(0)) {
+				frame.ip += offset
+			}
+		case opJumpIfTrue:
+			offset := frame.readShort(code)
+			if isTruthy(f.peek(0)) {
+				frame.ip += offset
+			}
+		case opJumpIfNil:
+			offset := frame.readShort(code)
+			if f.peek(0) == nil {
+				frame.ip += offset
+			}
+		case opJumpIfNotNil:
+			offset := frame.readShort(code)
+			if f.peek(0) != nil {
+				frame.ip += offset
+			}
+		case opJumpIfArg:
+			index := int(frame.readByte(code))
+			offset := frame.readShort(code)
+			if frame.argCount > index {
+				frame.ip += offset
+			}
+		case opLoop:
+			offset := frame.readShort(code)
+			frame.ip -= offset
+		case opCall:
+			argCount := int(frame.readByte(code))
+			if err := vm.callValue(f.peek(argCount), argCount, vm.token(frame)); err != nil {
+				return nil, err
+			}
+			frame = f.frames[len(f.frames)-1]
+			code, constants = frame.closure.function.chunk.code, frame.closure.function.chunk.constants
+		case opInvoke:
+			name := constants[frame.readShort(code)].(string)
+			argCount := int(frame.readByte(code))
+			if err := vm.invoke(name, argCount, frame); err != nil {
+				return nil, err
+			}
+			frame = f.frames[len(f.frames)-1]
+			code, constants = frame.closure.function.chunk.code, frame.closure.function.chunk.constants
+		case opCallList:
+			args := f.pop().(*loxList).elements
+			for _, arg := range args {
+				f.push(arg)
+			}
+			if err := vm.callValue(f.peek(len(args)), len(args), vm.token(frame)); err != nil {
+				return nil, err
+			}
+			frame = f.frames[len(f.frames)-1]
+			code, constants = frame.closure.function.chunk.code, frame.closure.function.chunk.constants
+		case opClosure:
+			function := constants[frame.readShort(code)].(*vmFunction)
+			closure := &vmClosure{function, make([]*vmUpvalue, function.upvalueCount)}
+			for n := range closure.upvalues {
+				isLocal, index := frame.readByte(code), int(frame.readByte(code))
+				if isLocal == 1 {
+					closure.upvalues[n] = f.capture(frame.slots + index)
+				} else {
+					closure.upvalues[n] = frame.closure.upvalues[index]
+				}
+			}
+			f.push(closure)
+		case opReturn, opReturnStashed:
+			var result any
+			if op == opReturn {
+				result = f.pop()
+			} else {
+				result = frame.stash
+			}
+			if vm.ret(result, base) {
+				return result, nil
+			}
+			frame = f.frames[len(f.frames)-1]
+			code, constants = frame.closure.function.chunk.code, frame.closure.function.chunk.constants
+		case opStash:
+			frame.stash = f.pop()
+		case opClass:
+			name := constants[frame.readShort(code)].(string)
+			var superclass *vmClass
+			if frame.readByte(code) == 1 {
+				class, ok := f.pop().(*vmClass)
+				if !ok {
+					return nil, newError("Superclass must be a class.", frame.line())
+				}
+				superclass = class
+			}
+			methods, staticMethods := make(map[string]*vmClosure), make(map[string]*vmClosure)
+			f.push(&vmClass{name, superclass, methods, staticMethods, make(map[string]any), vm})
+		case opSuperclass:
+			f.push(f.pop().(*vmClass).superclass)
+		case opMethod, opStaticMethod:
+			name := constants[frame.readShort(code)].(string)
+			method := f.pop().(*vmClosure)
+			class := f.peek(0).(*vmClass)
+			if op == opMethod {
+				class.methods[name] = method
+			} else {
+				class.staticMethods[name] = method
+			}
+		case opStaticField:
+			name := constants[frame.readShort(code)].(string)
+			value := f.pop()
+			f.peek(0).(*vmClass).fields[name] = value
+		case opList:
+			elements := make([]any, frame.readShort(code))
+			copy(elements, f.stack[len(f.stack)-len(elements):])
+			f.stack = f.stack[:len(f.stack)-len(elements)]
+			f.push(newList(elements))
+		case opAppend:
+			value := f.pop()
+			list := f.peek(0).(*loxList)
+			list.elements = append(list.elements, value)
+		case opAppendSpread:
+			it, err := vm.i.iterate(f.pop(), vm.token(frame))
+			if err != nil {
+				return nil, err
+			}
+			list := f.peek(0).(*loxList)
+			if list.elements, err = appendAll(list.elements, it); err != nil {
+				return nil, err
+			}
+		case opMap:
+			f.push(newMap())
+		case opMapSet:
+			value, key := f.pop(), f.pop()
+			if err := f.peek(0).(*loxMap).setAt(key, value, vm.token(frame)); err != nil {
+				return nil, err
+			}
+		case opInterpolate:
+			parts := make([]any, frame.readShort(code))
+			copy(parts, f.stack[len(f.stack)-len(parts):])
+			f.stack = f.stack[:len(f.stack)-len(parts)]
+			var b strings.Builder
+			for _, part := range parts {
+				str, err := vm.i.stringify(part)
+				if err != nil {
+					return nil, err
+				}
+				b.WriteString(str)
+			}
+			f.push(b.String())
+		case opIter:
+			it, err := vm.i.iterate(f.pop(), vm.token(frame))
+			if err != nil {
+				return nil, err
+			}
+			f.push(it)
+		case opForNext:
+			it := f.stack[frame.slots+int(frame.readByte(code))].(iterator)
+			offset := frame.readShort(code)
+			hasNext, err := it.hasNext()
+			if err != nil {
+				return nil, err
+			}
+			if !hasNext {
+				frame.ip += offset
+				break
+			}
+			value, err := it.next()
+			if err != nil {
+				return nil, err
+			}
+			f.push(value)
+		case opCloseIter:
+			it := f.stack[frame.slots+int(frame.readByte(code))]
+			if it, ok := it.(closer); ok {
+				if err := it.close(); err != nil {
+					return nil, err
+				}
+			}
+		case opTry, opTryFinally:
+			offset := frame.readShort(code)
+			handler := vmHandler{len(f.frames) - 1, len(f.stack), frame.ip + offset, op == opTryFinally}
+			f.handlers = append(f.handlers, handler)
+		case opEndTry:
+			f.handlers = f.handlers[:len(f.handlers)-1]
+		case opFinallyJump:
+			offset := frame.readShort(code)
+			f.push(finallyJump(frame.ip + offset))
+		case opEndFinally:
+			switch pending := f.pop().(type) {
+			case finallyJump:
+				frame.ip = int(pending)
+			case finallyThrow:
+				return nil, pending.err
+			}
+		case opThrow:
+			return nil, vm.throwValue(f.pop(), frame.line())
+		case opYield:
+			if f.closing {
+				f.pop()
+				break
+			}
+			f.yielded = true
+			return f.pop(), nil
+		case opJumpIfOpen:
+			offset := frame.readShort(code)
+			if !f.closing {
+				frame.ip += offset
+			}
+		case opImport:
+			path := constants[frame.readShort(code)].(string)
+			m, err := vm.i.importModule(path, vm.token(frame), vm.runScript)
+			if err != nil {
+				return nil, err
+			}
+			f.push(m)
+		case opExport:
+			name := constants[frame.readShort(code)].(string)
+			frame.closure.function.module.exports[name] = true
+		case opError:
+			message := constants[frame.readShort(code)].(string)
+			return nil, newError(message, frame.line())
+		}
+	}
+}
+
+func (f *vmFrame) readByte(code []byte) byte {
+	f.ip++
+	return code[f.ip-1]
+}
+
+func (f *vmFrame) readShort(code []byte) int {
+	f.ip += 2
+	return int(code[f.ip-2])<<8 | int(code[f.ip-1])
+}
+
+// line is the line of the instruction being executed.
+func (f *vmFrame) line() int {
+	return f.closure.function.chunk.lines[f.op]
+}
+
+// errorLine is the line of the outermost call the current instruction is in,
+// or line if it isn't in a call.
+func (f *vmFrame) errorLine(line int) int {
+	if call, ok := f.closure.function.chunk.calls[f.op]; ok {
+		return call
+	}
+	return line
+}
+
+func (f *vmFiber) push(value any) {
+	f.stack = append(f.stack, value)
+}
+
+func (f *vmFiber) pop() any {
+	value := f.stack[len(f.stack)-1]
+	f.stack = f.stack[:len(f.stack)-1]
+	return value
+}
+
+func (f *vmFiber) peek(distance int) any {
+	return f.stack[len(f.stack)-1-distance]
+}
+
+// capture returns the upvalue for a stack slot, which is shared by all
+// closures capturing the variable.
+func (f *vmFiber) capture(slot int) *vmUpvalue {
+	var prev *vmUpvalue
+	upvalue := f.open
+	for upvalue != nil && upvalue.slot > slot {
+		prev, upvalue = upvalue, upvalue.next
+	}
+	if upvalue != nil && upvalue.slot == slot {
+		return upvalue
+	}
+	created := &vmUpvalue{fiber: f, slot: slot, open: true, next: upvalue}
+	if prev == nil {
+		f.open = created
+	} else {
+		prev.next = created
+	}
+	return created
+}
+
+// closeUpvalues moves the variables from slot upwards off the stack into the
+// upvalues capturing them.
+func (f *vmFiber) closeUpvalues(slot int) {
+	for f.open != nil && f.open.slot >= slot {
+		upvalue := f.open
+		upvalue.closed = f.stack[upvalue.slot]
+		upvalue.open = false
+		f.open = upvalue.next
+	}
+}
+
+// token returns a token with the line of the instruction being executed for
+// the errors of the shared runtime.
+func (vm *vm) token(frame *vmFrame) token {
+	return newToken(IDENTIFIER, "", NULL, frame.line())
+}
+
+func (vm *vm) name(frame *vmFrame, constants []any) token {
+	name := constants[frame.readShort(frame.closure.function.chunk.code)].(string)
+	return newToken(IDENTIFIER, name, NULL, frame.line())
+}
+
+// node returns the expression the instruction being executed was compiled
+// from.
+func (vm *vm) node(frame *vmFrame) expression {
+	return frame.closure.function.chunk.nodes[frame.op]
+}
+
+// globals returns the tables global variables are looked up in: those of the
+// module of the executing function and the builtins of the VM, which have
+// their own Error class.
+func (vm *vm) globals(frame *vmFrame) []*globalTable {
+	return []*globalTable{frame.closure.function.module.globals, vm.builtins}
+}
+
+func (vm *vm) global(frame *vmFrame, name string) (any, error) {
+	for _, table := range vm.globals(frame) {
+		if value, ok := table.values[name]; ok {
+			return value, nil
+		}
+	}
+	return nil, newError(fmt.Sprintf("Undefined variable %s.", name), frame.line())
+}
+
+func (vm *vm) setGlobal(frame *vmFrame, name string, value any) error {
+	for _, table := range vm.globals(frame) {
+		if _, ok := table.values[name]; ok {
+			table.values[name] = value
+			return nil
+		}
+	}
+	return newError(fmt.Sprintf("Undefined variable %s.", name), frame.line())
+}
+
+func (vm *vm) getProperty(object any, name token, node expression) (any, error) {
+	switch object := object.(type) {
+	case *vmInstance:
+		return object.get(vm.i, name)
+	case *vmClass:
+		return object.get(vm.i, name)
+	case *loxList:
+		return object.get(name)
+	case *loxMap:
+		return object.get(name)
+	case *loxModule:
+		return object.get(name)
+	case *vmGenerator:
+		return generatorGet(object, name)
+	}
+	return nil, newError("Only instances have properties.", node.token().line)
+}
+
+// object checks that the object of a field assignment is an instance or a
+// class.
+func (vm *vm) object(value any, frame *vmFrame) (loxObject, error) {
+	object, ok := value.(loxObject)
+	if !ok {
+		return nil, newError("Only instances have fields.", vm.node(frame).token().line)
+	}
+	return object, nil
+}
+
+func (vm *vm) super(this any, superclass *vmClass, name token) (any, error) {
+	var method *vmClosure
+	if _, ok := this.(*vmClass); ok {
+		method = superclass.findStatic(name.lexeme)
+	} else {
+		method = superclass.findMethod(name.lexeme)
+	}
+	if method == nil {
+		return nil, newError(fmt.Sprintf("Undefined property '%s'.", name.lexeme), name.line)
+	}
+	return vm.property(&vmBoundMethod{this, method}, name)
+}
+
+func (vm *vm) arithmetic(op opCode, a any, b any, frame *vmFrame) (any, error) {
+	left, ok := a.(float64)
+	right, ok2 := b.(float64)
+	if !ok || !ok2 {
+		node := vm.node(frame)
+		if result, ok, err := vm.i.overload(a, node.token(), b); ok || err != nil {
+			return result, err
+		}
+		if op == opAdd {
+			if ok, a, b := vm.i.areStrings(a, b); ok {
+				return fmt.Sprintf("%v%v", a, b), nil
+			}
+		}
+		var err error
+		if left, right, err = vm.i.numbers(a, b, node); err != nil {
+			return nil, err
+		}
+	}
+	switch op {
+	case opAdd:
+		return left + right, nil
+	case opSubtract:
+		return left - right, nil
+	case opMultiply:
+		return left * right, nil
+	case opDivide:
+		return left / right, nil
+	case opModulo:
+		return math.Mod(left, right), nil
+	}
+	return math.Trunc(left / right), nil
+}
+
+func (vm *vm) compare(op opCode, a any, b any, frame *vmFrame) (any, error) {
+	left, ok := a.(float64)
+	right, ok2 := b.(float64)
+	if !ok || !ok2 {
+		node := vm.node(frame)
+		if result, ok, err := vm.i.compare(a, node.token(), b); ok || err != nil {
+			return result, err
+		}
+		var err error
+		if left, right, err = vm.i.numbers(a, b, node); err != nil {
+			return nil, err
+		}
+	}
+	switch op {
+	case opGreater:
+		return left > right, nil
+	case opGreaterEqual:
+		return left >= right, nil
+	case opLess:
+		return left < right, nil
+	}
+	return left <= right, nil
+}
+
+func (vm *vm) bitwise(op opCode, a any, b any, frame *vmFrame) (any, error) {
+	node := vm.node(frame)
+	left, err := vm.i.integer(a, node.expr())
+	if err != nil {
+		return nil, err
+	}
+	right, err := vm.i.integer(b, node.next())
+	if err != nil {
+		return nil, err
+	}
+	switch op {
+	case opBitAnd:
+		return float64(left & right), nil
+	case opBitOr:
+		return float64(left | right), nil
+	case opBitXor:
+		return float64(left ^ right), nil
+	}
+	if right < 0 {
+		return nil, newError(fmt.Sprintf("Shift count can't be negative: %v", right), node.token().line)
+	}
+	if op == opShiftLeft {
+		return float64(left << right), nil
+	}
+	return float64(left >> right), nil
+}
+
+// callValue calls the callee below the arguments on the stack like a call
+// expression, which checks the number of arguments.
+func (vm *vm) callValue(callee any, argCount int, t token) error {
+	if call := specialMethod(callee, "__call__"); call != nil {
+		callee = call
+		vm.fiber.stack[len(vm.fiber.stack)-1-argCount] = call
+	}
+	function, ok := callee.(callable)
+	if !ok {
+		return newError("Can only call functions and classes.", t.line)
+	}
+	if err := checkArity(function, argCount, t); err != nil {
+		return err
+	}
+	return vm.enter(callee, argCount, t)
+}
+
+// enter starts a call of the callee below the arguments on the stack. Calls
+// of compiled functions push a frame, other calls replace the callee and the
+// arguments with the result.
+func (vm *vm) enter(callee any, argCount int, t token) error {
+	f := vm.fiber
+	slot := len(f.stack) - 1 - argCount
+	switch callee := callee.(type) {
+	case *vmClosure:
+		return vm.callClosure(callee, argCount)
+	case *vmBoundMethod:
+		f.stack[slot] = callee.receiver
+		return vm.callClosure(callee.method, argCount)
+	case *vmClass:
+		f.stack[slot] = &vmInstance{callee, make(map[string]any)}
+		if init := callee.findMethod("init"); init != nil {
+			return vm.callClosure(init, argCount)
+		}
+		f.stack = f.stack[:slot+1]
+	case callable:
+		args := make([]any, argCount)
+		copy(args, f.stack[slot+1:])
+		f.stack = f.stack[:slot]
+		result, err := callee.call(vm.i, args, t)
+		if err != nil {
+			return err
+		}
+		f.push(result)
+	}
+	return nil
+}
+
+// invoke calls the method of the object below the arguments without binding
+// it first.
+func (vm *vm) invoke(name string, argCount int, frame *vmFrame) error {
+	f := vm.fiber
+	slot := len(f.stack) - 1 - argCount
+	get := vm.node(frame).(*expressionGet)
+	t := vm.token(frame)
+	if instance, ok := f.stack[slot].(*vmInstance); ok {
+		if _, ok := instance.fields[name]; !ok {
+			method := instance.class.findMethod(name)
+			if method != nil && !method.function.getter {
+				if err := checkArity(method, argCount, t); err != nil {
+					return err
+				}
+				return vm.callClosure(method, argCount)
+			}
+		}
+	}
+	callee, err := vm.getProperty(f.stack[slot], get.name, get)
+	if err != nil {
+		return err
+	}
+	f.stack[slot] = callee
+	return vm.callValue(callee, argCount, t)
+}
+
+func (vm *vm) callClosure(closure *vmClosure, argCount int) error {
+	f := vm.fiber
+	if closure.function.generator {
+		slot := len(f.stack) - 1 - argCount
+		args := make([]any, argCount)
+		copy(args, f.stack[slot+1:])
+		receiver := f.stack[slot]
+		f.stack = f.stack[:slot]
+		f.push(newVMGenerator(vm, closure, receiver, args))
+		return nil
+	}
+	if len(f.frames) >= maxFrames {
+		return newError("Stack overflow.", f.frames[len(f.frames)-1].line())
+	}
+	vm.pushFrame(closure, argCount)
+	return nil
+}
+
+// pushFrame starts running the closure with the arguments on the stack. The
+// missing arguments are nil until the function sets their default values,
+// and the rest parameter gets a list of the remaining arguments.
+func (vm *vm) pushFrame(closure *vmClosure, argCount int) {
+	f := vm.fiber
+	function := closure.function
+	fixed := len(function.params)
+	if function.variadic {
+		fixed--
+	}
+	slot := len(f.stack) - 1 - argCount
+	if argCount > fixed {
+		if function.variadic {
+			rest := make([]any, argCount-fixed)
+			copy(rest, f.stack[slot+1+fixed:])
+			f.stack = append(f.stack[:slot+1+fixed], newList(rest))
+		} else {
+			f.stack = f.stack[:slot+1+fixed]
+		}
+	} else {
+		for n := argCount; n < fixed; n++ {
+			f.push(nil)
+		}
+		if function.variadic {
+			f.push(newList([]any{}))
+		}
+	}
+	n := len(f.frames)
+	if n < cap(f.frames) && f.frames[:n+1][n] != nil {
+		f.frames = f.frames[:n+1]
+	} else {
+		f.frames = append(f.frames, &vmFrame{})
+	}
+	*f.frames[n] = vmFrame{closure: closure, slots: slot, argCount: argCount}
+}
+
+// ret returns from the current frame and reports whether it was the frame
+// at index base.
+func (vm *vm) ret(result any, base int) bool {
+	f := vm.fiber
+	frame := f.frames[len(f.frames)-1]
+	f.closeUpvalues(frame.slots)
+	f.stack = f.stack[:frame.slots]
+	f.frames = f.frames[:len(f.frames)-1]
+	for len(f.handlers) > 0 && f.handlers[len(f.handlers)-1].frame >= len(f.frames) {
+		f.handlers = f.handlers[:len(f.handlers)-1]
+	}
+	if len(f.frames) == base {
+		return true
+	}
+	f.push(result)
+	return false
+}
+
+// throwValue returns the error raised by throwing value.
+func (vm *vm) throwValue(value any, line int) error {
+	message, err := vm.i.stringify(value)
+	if err != nil {
+		return err
+	}
+	if instance, ok := vm.isErrorObject(value); ok {
+		if message, err = vm.i.stringify(instance.fields["message"]); err != nil {
+			return err
+		}
+		instance.fields["line"] = float64(line)
+		instance.fields["stack"] = vm.stackTrace(line)
+	}
+	thrown := newError(message, line)
+	thrown.value, thrown.thrown = value, true
+	return thrown
+}
+
+// throw jumps to the innermost handler in the frames run from base on. If
+// there is none, the frames are unwound and the error is returned. Like in
+// the interpreter, errors take the line of the outermost call they are in
+// within each function they leave.
+func (vm *vm) throw(err loxError, base int) error {
+	f := vm.fiber
+	err.line = f.frames[len(f.frames)-1].errorLine(err.line)
+	if !err.hasValue() {
+		err.value = vm.errorObject(err.message, err.line)
+	}
+	if n := len(f.handlers); n > 0 && f.handlers[n-1].frame >= base {
+		handler := f.handlers[n-1]
+		f.handlers = f.handlers[:n-1]
+		if handler.frame < len(f.frames)-1 {
+			err.line = f.frames[handler.frame].errorLine(err.line)
+		}
+		f.closeUpvalues(handler.stack)
+		f.stack = f.stack[:handler.stack]
+		f.frames = f.frames[:handler.frame+1]
+		f.frames[handler.frame].ip = handler.target
+		if handler.finally {
+			f.push(finallyThrow{err})
+		} else {
+			f.push(err.value)
+		}
+		return nil
+	}
+	frame := f.frames[base]
+	err.line = frame.errorLine(err.line)
+	f.closeUpvalues(frame.slots)
+	f.stack = f.stack[:frame.slots]
+	f.frames = f.frames[:base]
+	return err
+}
+
+func (vm *vm) errorObject(message string, line int) *vmInstance {
+	fields := map[string]any{
+		"message": message,
+		"line":    float64(line),
+		"stack":   vm.stackTrace(line),
+	}
+	return &vmInstance{vm.errorClass, fields}
+}
+
+func (vm *vm) isErrorObject(value any) (*vmInstance, bool) {
+	instance, ok := value.(*vmInstance)
+	if !ok {
+		return nil, false
+	}
+	for class := instance.class; class != nil; class = class.superclass {
+		if class == vm.errorClass {
+			return instance, true
+		}
+	}
+	return nil, false
+}
+
+// stackTrace lists the active calls of the fiber and the fibers that resumed
+// it, starting with the innermost one which is currently at the given line.
+func (vm *vm) stackTrace(line int) string {
+	trace := []string{}
+	for f := vm.fiber; f != nil; f = f.parent {
+		for n := len(f.frames) - 1; n >= 0; n-- {
+			function := f.frames[n].closure.function
+			if function.kind == none {
+				continue
+			}
+			trace = append(trace, fmt.Sprintf("at %s [line %d]", function.name, line))
+			if n > 0 {
+				line = f.frames[n-1].line()
+			} else if f.parent != nil && len(f.parent.frames) > 0 {
+				line = f.parent.frames[len(f.parent.frames)-1].line()
+			}
+		}
+	}
+	trace = append(trace, fmt.Sprintf("at <script> [line %d]", line))
+	return strings.Join(trace, "\n")
+}
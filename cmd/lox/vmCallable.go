@@ -0,0 +1,161 @@
+package lox
+
+import "fmt"
+
+// vmFunction is a function compiled to bytecode. Scripts and modules are
+// compiled to functions of kind none without parameters.
+type vmFunction struct {
+	name  string
+	chunk *chunk
+	paramList
+	upvalueCount int
+	kind         fnType
+	generator    bool
+	getter       bool
+	// module holds the globals of the function.
+	module *loxModule
+}
+
+// vmClosure is a function with the variables it captured from the functions
+// it was declared in.
+type vmClosure struct {
+	function *vmFunction
+	upvalues []*vmUpvalue
+}
+
+// vmUpvalue is a captured variable. It refers to the stack slot of the
+// variable while it is in scope, and holds its value once it is closed.
+type vmUpvalue struct {
+	fiber  *vmFiber
+	slot   int
+	closed any
+	open   bool
+	// next is the open upvalue of the fiber with the next lower slot.
+	next *vmUpvalue
+}
+
+type vmClass struct {
+	name          string
+	superclass    *vmClass
+	methods       map[string]*vmClosure
+	staticMethods map[string]*vmClosure
+	fields        map[string]any
+	vm            *vm
+}
+
+type vmInstance struct {
+	class  *vmClass
+	fields map[string]any
+}
+
+// vmBoundMethod is a method with 'this' set to the instance, or to the class
+// for static methods.
+type vmBoundMethod struct {
+	receiver any
+	method   *vmClosure
+}
+
+func (f *vmFunction) String() string {
+	if f.kind == none {
+		return "<script>"
+	}
+	return "<fn " + f.name + ">"
+}
+
+func (u *vmUpvalue) get() any {
+	if u.open {
+		return u.fiber.stack[u.slot]
+	}
+	return u.closed
+}
+
+func (u *vmUpvalue) set(value any) {
+	if u.open {
+		u.fiber.stack[u.slot] = value
+		return
+	}
+	u.closed = value
+}
+
+func (c *vmClosure) String() string    { return c.function.String() }
+func (c *vmClosure) arity() (int, int) { return c.function.arity() }
+func (c *vmClosure) call(i *interpreter, args []any, t token) (any, error) {
+	return i.vm.call(c, args, t)
+}
+
+func (b *vmBoundMethod) String() string    { return b.method.String() }
+func (b *vmBoundMethod) arity() (int, int) { return b.method.arity() }
+func (b *vmBoundMethod) call(i *interpreter, args []any, t token) (any, error) {
+	return i.vm.call(b, args, t)
+}
+
+func (c *vmClass) String() string { return "<class " + c.name + ">" }
+func (c *vmClass) arity() (int, int) {
+	if init := c.findMethod("init"); init != nil {
+		return init.arity()
+	}
+	return 0, 0
+}
+func (c *vmClass) call(i *interpreter, args []any, t token) (any, error) {
+	return i.vm.call(c, args, t)
+}
+
+func (c *vmClass) findMethod(name string) *vmClosure {
+	for class := c; class != nil; class = class.superclass {
+		if method, ok := class.methods[name]; ok {
+			return method
+		}
+	}
+	return nil
+}
+
+func (c *vmClass) findStatic(name string) *vmClosure {
+	for class := c; class != nil; class = class.superclass {
+		if method, ok := class.staticMethods[name]; ok {
+			return method
+		}
+	}
+	return nil
+}
+
+// get returns a static field or a static method bound to the class. Both are
+// inherited from the superclass.
+func (c *vmClass) get(_ *interpreter, name token) (any, error) {
+	for class := c; class != nil; class = class.superclass {
+		if val, ok := class.fields[name.lexeme]; ok {
+			return val, nil
+		}
+	}
+	if m := c.findStatic(name.lexeme); m != nil {
+		return c.vm.property(&vmBoundMethod{c, m}, name)
+	}
+	return nil, newError(fmt.Sprintf("Undefined property '%s'.", name.lexeme), name.line)
+}
+
+func (c *vmClass) set(name token, value any) {
+	c.fields[name.lexeme] = value
+}
+
+func (i *vmInstance) String() string { return i.class.name + " instance" }
+func (i *vmInstance) get(_ *interpreter, name token) (any, error) {
+	if val, ok := i.fields[name.lexeme]; ok {
+		return val, nil
+	}
+	if m := i.class.findMethod(name.lexeme); m != nil {
+		return i.class.vm.property(&vmBoundMethod{i, m}, name)
+	}
+	return nil, newError(fmt.Sprintf("Undefined property '%s'.", name.lexeme), name.line)
+}
+
+func (i *vmInstance) set(name token, value any) {
+	i.fields[name.lexeme] = value
+}
+
+// property is the value of a bound method accessed as a property, which is
+// the result of calling it for getters.
+func (vm *vm) property(method *vmBoundMethod, name token) (any, error) {
+	if method.method.function.getter {
+		return vm.call(method, nil, name)
+	}
+	return method, nil
+}
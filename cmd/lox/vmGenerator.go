@@ -0,0 +1,100 @@
+package lox
+
+// vmGenerator is returned by calling a compiled function containing 'yield'.
+// The body runs in a fiber of its own, which next() resumes on top of the
+// caller's fiber until the body yields or returns.
+type vmGenerator struct {
+	vm       *vm
+	closure  *vmClosure
+	fiber    *vmFiber
+	value    any
+	buffered bool
+	started  bool
+	running  bool
+	done     bool
+}
+
+func newVMGenerator(vm *vm, closure *vmClosure, receiver any, args []any) *vmGenerator {
+	g := &vmGenerator{vm: vm, closure: closure, fiber: &vmFiber{}}
+	caller := vm.fiber
+	vm.fiber = g.fiber
+	g.fiber.push(receiver)
+	for _, arg := range args {
+		g.fiber.push(arg)
+	}
+	vm.pushFrame(closure, len(args))
+	vm.fiber = caller
+	return g
+}
+
+func (g *vmGenerator) String() string {
+	return "<generator " + g.closure.function.name + ">"
+}
+
+func (g *vmGenerator) hasNext(i *interpreter, t token) (bool, error) {
+	err := g.advance(t)
+	return g.buffered, err
+}
+
+func (g *vmGenerator) next(i *interpreter, t token) (any, error) {
+	if err := g.advance(t); err != nil {
+		return nil, err
+	}
+	if !g.buffered {
+		return nil, newError("Generator has no more values.", t.line)
+	}
+	g.buffered = false
+	return g.value, nil
+}
+
+// advance runs the body until the next yield unless a value is buffered.
+// Errors in the body are returned to the caller.
+func (g *vmGenerator) advance(t token) error {
+	if g.buffered || g.done {
+		return nil
+	}
+	if g.running {
+		return newError("Generator is already running.", t.line)
+	}
+	g.started = true
+	value, err := g.resume()
+	if err != nil || !g.fiber.yielded {
+		g.done = true
+		return err
+	}
+	g.fiber.yielded = false
+	g.value, g.buffered = value, true
+	return nil
+}
+
+// close ends a generator suspended at a yield. The yield returns, so the
+// finally blocks around it run, and the errors they raise are returned.
+func (g *vmGenerator) close(i *interpreter, t token) error {
+	if g.done {
+		return nil
+	}
+	if g.running {
+		return newError("Generator is already running.", t.line)
+	}
+	g.done, g.buffered = true, false
+	if !g.started {
+		return nil
+	}
+	g.fiber.closing = true
+	_, err := g.resume()
+	return err
+}
+
+// resume runs the fiber of the body on top of the current one until it
+// yields or returns.
+func (g *vmGenerator) resume() (any, error) {
+	vm := g.vm
+	g.running = true
+	g.fiber.parent = vm.fiber
+	vm.fiber = g.fiber
+	value, err := vm.run(0)
+	vm.fiber = g.fiber.parent
+	g.fiber.parent = nil
+	g.running = false
+	return value, err
+}
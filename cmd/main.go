@@ -4,24 +4,26 @@ import (
 	"fmt"
 	"lox/cmd/lox"
 	"os"
+	"strings"
 )
 
+// engine runs scripts with the 'run' command: "tree" walks the syntax tree
+// and "vm" compiles it to bytecode.
+var engine = "tree"
+
 func main() {
-	if len(os.Args) == 1 {
+	args := parseOptions(os.Args[1:])
+	if len(args) == 0 {
 		lox.Repl()
 		return
 	}
-	if len(os.Args) == 2 {
-		handleRunCommand(os.Args[1])
+	if len(args) == 1 {
+		handleRunCommand(args[0])
 		return
 	}
-	if len(os.Args) < 3 {
-		fmt.Fprintln(os.Stderr, "Usage: ./your_program.sh <command> <filename>")
-		os.Exit(1)
-	}
 
-	command := os.Args[1]
-	fileName := os.Args[2]
+	command := args[0]
+	fileName := args[1]
 
 	switch command {
 	case "tokenize":
@@ -32,6 +34,8 @@ func main() {
 		handleEvaluateCommand(fileName)
 	case "run":
 		handleRunCommand(fileName)
+	case "disasm":
+		handleDisasmCommand(fileName)
 
 	default:
 		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", command)
@@ -39,6 +43,51 @@ func main() {
 	}
 }
 
+// parseOptions applies the options in args and returns the remaining
+// arguments. '--lib <dir>' or '--lib=<dir>' adds a directory to the search
+// path of imports and '--engine=tree|vm' selects the engine. '--trace' runs
+// scripts on the VM and prints every instruction it executes, so it can't be
+// combined with '--engine=tree'.
+func parseOptions(args []string) []string {
+	rest := []string{}
+	trace, engineOption := false, ""
+	for n := 0; n < len(args); n++ {
+		switch {
+		case args[n] == "--lib":
+			if n+1 == len(args) {
+				fmt.Fprintln(os.Stderr, "Usage: --lib <directory>")
+				os.Exit(1)
+			}
+			n++
+			lox.AddLibrary(args[n])
+		case strings.HasPrefix(args[n], "--lib="):
+			lox.AddLibrary(strings.TrimPrefix(args[n], "--lib="))
+		case args[n] == "--trace":
+			trace = true
+		case strings.HasPrefix(args[n], "--engine="):
+			engineOption = strings.TrimPrefix(args[n], "--engine=")
+			if engineOption != "tree" && engineOption != "vm" {
+				fmt.Fprintf(os.Stderr, "Unknown engine: %s\n", engineOption)
+				os.Exit(1)
+			}
+		default:
+			rest = append(rest, args[n])
+		}
+	}
+	if trace {
+		if engineOption == "tree" {
+			fmt.Fprintln(os.Stderr, "--trace can't be used with --engine=tree")
+			os.Exit(1)
+		}
+		engineOption = "vm"
+		lox.EnableTrace()
+	}
+	if engineOption != "" {
+		engine = engineOption
+	}
+	return rest
+}
+
 func handleTokenizeCommand(fileName string) {
 	ok := lox.Tokenize(fileName)
 	if !ok {
@@ -60,8 +109,19 @@ func handleEvaluateCommand(fileName string) {
 	}
 }
 
+func handleDisasmCommand(fileName string) {
+	ok := lox.Disassemble(fileName)
+	if !ok {
+		os.Exit(65)
+	}
+}
+
 func handleRunCommand(fileName string) {
-	ok := lox.Run(fileName)
+	run := lox.Run
+	if engine == "vm" {
+		run = lox.RunVM
+	}
+	ok := run(fileName)
 	if !ok {
 		os.Exit(65)
 	}
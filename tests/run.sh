@@ -0,0 +1,53 @@
+#!/bin/sh
+# Runs every .lox file below this directory and compares its output with
+# the expectations written as comments in the file:
+#
+#   // expect: <line printed to stdout>
+#   // expect error: <line printed to stderr>
+#   // expect exit: <exit status>
+#
+# A file with a .disasm file next to it must also compile to the bytecode
+# listed in it with 'lox disasm'.
+#
+# Files in helpers directories are only imported by other tests. The
+# modules in tests/modules/helpers/lib are found through LOX_PATH.
+#
+# Usage: tests/run.sh [path/to/lox [options...]]
+#
+# The options are passed to 'lox run', like --engine=vm.
+
+lox=${1:-./lox}
+[ $# -gt 0 ] && shift
+dir=$(dirname "$0")
+tmp=$(mktemp -d)
+export LOX_PATH="$dir/modules/helpers/lib"
+trap 'rm -rf "$tmp"' EXIT
+passed=0
+failed=0
+
+for file in $(find "$dir" -name '*.lox' -not -path '*/helpers/*' | sort); do
+	sed -n 's|.*// expect: ||p' "$file" >"$tmp/expected"
+	sed -n 's|.*// expect error: ||p' "$file" >"$tmp/expectedErr"
+	status=$(sed -n 's|.*// expect exit: ||p' "$file")
+	"$lox" run "$@" "$file" >"$tmp/actual" 2>"$tmp/actualErr"
+	actualStatus=$?
+	disasm="${file%.lox}.disasm"
+	if [ -f "$disasm" ]; then
+		"$lox" disasm "$file" >"$tmp/actualDisasm" 2>&1
+	fi
+	if cmp -s "$tmp/expected" "$tmp/actual" && cmp -s "$tmp/expectedErr" "$tmp/actualErr" &&
+		{ [ -z "$status" ] || [ "$status" -eq "$actualStatus" ]; } &&
+		{ [ ! -f "$disasm" ] || cmp -s "$disasm" "$tmp/actualDisasm"; }; then
+		passed=$((passed + 1))
+		continue
+	fi
+	failed=$((failed + 1))
+	echo "FAIL $file"
+	diff "$tmp/expected" "$tmp/actual"
+	diff "$tmp/expectedErr" "$tmp/actualErr"
+	[ -n "$status" ] && echo "exit status $actualStatus, expected $status"
+	[ -f "$disasm" ] && diff "$disasm" "$tmp/actualDisasm"
+done
+
+echo "$passed passed, $failed failed"
+[ "$failed" -eq 0 ]